@@ -1,118 +1,1277 @@
 package astro
 
 import (
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // ExtractGraphFromAST extracts a graph from the given source code (go file).
 //
 // It utilizes the go/ast package to parse the source code and build the graph.
+// Problems met while extracting the graph are recorded in its Diagnostics.
 //
 // Consideration: use a treesitter parser instead of go/ast to support more languages than just Go
 func ExtractGraphFromAST(src string) (*Graph, error) {
+	return extractGraph(src, extractOptions{})
+}
+
+// ExtractGraphWithCFG extracts a graph like ExtractGraphFromAST, and additionally
+// builds the intra-procedural control-flow graph of every function declaration.
+//
+// See buildCFG for the shape of the basic blocks and edges that are added.
+func ExtractGraphWithCFG(src string) (*Graph, error) {
+	return extractGraph(src, extractOptions{withCFG: true})
+}
+
+// ExtractGraphWithMode extracts a graph like ExtractGraphFromAST, handling diagnostics
+// according to mode.
+//
+// In Lenient mode, a file with syntax errors is extracted as far as the parser could
+// make sense of it, and the syntax errors are recorded as diagnostics. In Strict mode,
+// the extraction fails with a *DiagnosticError if any diagnostic has the severity of a
+// warning or an error.
+func ExtractGraphWithMode(src string, mode Mode) (*Graph, error) {
+	return extractGraph(src, extractOptions{mode: mode, partial: true})
+}
+
+// extractOptions configures an extraction. The zero value extracts like ExtractGraphFromAST
+// and ExtractGraphFromDir.
+type extractOptions struct {
+	withCFG       bool
+	mode          Mode
+	partial       bool  // extract files with syntax errors
+	tests         bool  // extract test files of directories
+	maxFileSize   int64 // skip larger files, if positive
+	qualification Qualification
+	plugins       []Plugin
+	instances     bool // extract a node per instantiation of generic functions
+}
+
+func extractGraph(src string, opts extractOptions) (*Graph, error) {
 	fset := token.NewFileSet()
+	graph := NewGraph()
+
+	if opts.maxFileSize > 0 && int64(len(src)) > opts.maxFileSize {
+		graph.Diagnostics = append(graph.Diagnostics, skippedFile("", int64(len(src)), opts.maxFileSize))
+		return graph, checkMode(graph, opts.mode)
+	}
 
-	f, err := parser.ParseFile(fset, "", src, 0)
+	f, err := parser.ParseFile(fset, "", src, parser.AllErrors)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing file: %s", err)
+		if !opts.partial {
+			return nil, fmt.Errorf("error parsing file: %s", err)
+		}
+		syntaxDiagnostics(graph, err)
+		if f == nil || f.Name == nil {
+			return graph, nil
+		}
+	}
+
+	pkg := &parsedPackage{path: f.Name.Name, files: []*ast.File{f}}
+	tc := newTypeChecker(fset, pkg)
+	tc.check(pkg.path)
+
+	e := newExtractor(fset, graph, opts.withCFG)
+	e.info = tc.info
+	e.qualification = opts.qualification
+	if e.qualification == QualifyDefault {
+		e.qualification = QualifyNone
 	}
+	e.plugins = opts.plugins
+	e.instances = opts.instances
+	e.tree = tc.sources
+	e.typeDiagnostics(tc.errors[pkg.path])
+	e.extract(f)
+
+	if err := checkMode(graph, opts.mode); err != nil {
+		return nil, err
+	}
+
+	return e.graph, nil
+}
+
+// ExtractGraphFromDir extracts a single graph from every package found under root.
+//
+// Each directory containing Go files is extracted as one package, identified by its import
+// path: the module path declared in root/go.mod joined with the directory, or the directory
+// relative to root without a go.mod. Functions are qualified with the import path of their
+// package, so that functions of different packages sharing a name are kept apart, e.g.
+// "example.com/app/store.Open", and so are methods, e.g. "example.com/app/store.Server.Close".
+//
+// Test files, hidden directories, and vendor and testdata directories are skipped.
+func ExtractGraphFromDir(root string) (*Graph, error) {
+	return extractDir(root, extractOptions{})
+}
 
+func extractDir(root string, opts extractOptions) (*Graph, error) {
+	fset := token.NewFileSet()
 	graph := NewGraph()
-	currentFunc := NewNode(Unknown, "")
-
-	ast.Inspect(f, func(n ast.Node) bool {
-		switch x := n.(type) {
-		case *ast.FuncDecl:
-			// create function node and add it to graph
-			funcNode := NewNode(Func, x.Name.Name)
-			graph.Nodes = append(graph.Nodes, funcNode)
-
-			// set current function
-			currentFunc = funcNode
-
-			// TODO: handle return values
-			graph = graph.hasReturn(x.Type, currentFunc)
-
-		case *ast.GenDecl:
-			// variable declaration
-			if x.Tok == token.VAR {
-				for _, spec := range x.Specs {
-					if vs, ok := spec.(*ast.ValueSpec); ok {
-						for _, name := range vs.Names {
-							varNode := NewNode(Var, name.Name)
-							graph.Nodes = append(graph.Nodes, varNode)
-
-							graph.AddEdge(currentFunc, varNode, Declares)
-						}
-					}
-				}
+
+	pkgs, err := parseDir(fset, root, opts, func(path string, diagnostics []Diagnostic) {
+		graph.Diagnostics = append(graph.Diagnostics, diagnostics...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tc := newTypeChecker(fset, pkgs...)
+	shared := newSharedNodes()
+	for _, pkg := range pkgs {
+		tc.check(pkg.path)
+		e := shared.extractor(fset, graph, tc, pkg.path, opts)
+		e.extract(pkg.files...)
+	}
+
+	if err := checkMode(graph, opts.mode); err != nil {
+		return nil, err
+	}
+
+	return graph, nil
+}
+
+// sharedNodes holds the nodes shared by the packages of a directory extraction, which
+// are identified by something else than their name.
+type sharedNodes struct {
+	packages    map[string]*Node // every package has a single node
+	pluginNodes map[pluginNodeKey]*Node
+	fields      map[*types.Var]*Node
+	globals     map[*types.Var]*Node
+	mutexVars   map[*types.Var]*Node
+}
+
+func newSharedNodes() *sharedNodes {
+	return &sharedNodes{
+		packages:    make(map[string]*Node),
+		pluginNodes: make(map[pluginNodeKey]*Node),
+		fields:      make(map[*types.Var]*Node),
+		globals:     make(map[*types.Var]*Node),
+		mutexVars:   make(map[*types.Var]*Node),
+	}
+}
+
+// extractor returns an extractor of the package with the given import path, which must
+// have been type-checked by tc. The type errors of the package are recorded as diagnostics.
+func (s *sharedNodes) extractor(fset *token.FileSet, graph *Graph, tc *typeChecker, path string, opts extractOptions) *extractor {
+	e := newExtractor(fset, graph, opts.withCFG)
+	e.info = tc.info
+	e.qualification = opts.qualification
+	if e.qualification == QualifyDefault {
+		e.qualification = QualifyPath
+	}
+	e.typeDiagnostics(tc.errors[path])
+	e.pkgPath = path
+	e.packages = s.packages
+	e.plugins = opts.plugins
+	e.pluginNodes = s.pluginNodes
+	e.fields = s.fields
+	e.globals = s.globals
+	e.mutexVars = s.mutexVars
+	e.tree = tc.sources
+	e.instances = opts.instances
+	return e
+}
+
+// parsedPackage holds the parsed files of a package directory.
+type parsedPackage struct {
+	path  string
+	files []*ast.File
+}
+
+// parseDir parses the packages found under root, sorted by import path. Files that
+// are skipped or only partially parsed are reported to diagnose.
+//
+// When test files are extracted, the external test package of a directory, declared
+// in files of a package with the "_test" suffix, is a package of its own whose import
+// path has the same suffix.
+func parseDir(fset *token.FileSet, root string, opts extractOptions, diagnose func(path string, diagnostics []Diagnostic)) ([]*parsedPackage, error) {
+	modPath := modulePath(root)
+	byPath := make(map[string]*parsedPackage)
+	var pkgs []*parsedPackage
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && isSkippedDir(name) {
+				return filepath.SkipDir
 			}
+			return nil
+		}
+		if !isSourceFile(name, opts) {
+			return nil
+		}
 
-		case *ast.Ident:
-			checkVarUsage(currentFunc, graph, x)
+		f, diagnostics, err := parseFile(fset, path, nil, opts)
+		if len(diagnostics) > 0 {
+			diagnose(path, diagnostics)
+		}
+		if err != nil || f == nil {
+			return err
+		}
 
-		case *ast.CallExpr:
-			if err := processCall(x, graph, currentFunc); err != nil {
-				return false
+		pkgPath := filePackage(modPath, root, path, f)
+		pkg, ok := byPath[pkgPath]
+		if !ok {
+			pkg = &parsedPackage{path: pkgPath}
+			byPath[pkgPath] = pkg
+			pkgs = append(pkgs, pkg)
+		}
+		pkg.files = append(pkg.files, f)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].path < pkgs[j].path
+	})
+
+	return pkgs, nil
+}
+
+// isSourceFile reports whether the file with the given name is extracted.
+func isSourceFile(name string, opts extractOptions) bool {
+	return strings.HasSuffix(name, ".go") && (!strings.HasSuffix(name, "_test.go") || opts.tests)
+}
+
+// isSkippedDir reports whether the directory with the given name is skipped.
+func isSkippedDir(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata"
+}
+
+// parseFile parses the file at path, reading it unless src is given. It returns a nil
+// file if the file is skipped for its size, and the diagnostics of the files skipped or
+// only partially parsed.
+func parseFile(fset *token.FileSet, path string, src []byte, opts extractOptions) (*ast.File, []Diagnostic, error) {
+	if opts.maxFileSize > 0 {
+		size := int64(len(src))
+		if src == nil {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, nil, err
 			}
+			size = info.Size()
+		}
+		if size > opts.maxFileSize {
+			return nil, []Diagnostic{skippedFile(path, size, opts.maxFileSize)}, nil
+		}
+	}
 
-			// handling variables passed as parameters in function calls
-			for _, arg := range x.Args {
-				if ident, ok := arg.(*ast.Ident); ok {
-					checkVarUsage(currentFunc, graph, ident)
-				}
+	var source any
+	if src != nil {
+		source = src
+	}
+	f, err := parser.ParseFile(fset, path, source, parser.AllErrors)
+	if err != nil {
+		if !opts.partial || f == nil || f.Name == nil {
+			return nil, nil, fmt.Errorf("error parsing file: %s", err)
+		}
+		scratch := NewGraph()
+		syntaxDiagnostics(scratch, err)
+		return f, scratch.Diagnostics, nil
+	}
+
+	return f, nil, nil
+}
+
+// filePackage returns the import path of the package declared by f, found at path.
+func filePackage(modPath, root, path string, f *ast.File) string {
+	pkgPath := importPath(modPath, root, filepath.Dir(path))
+	if strings.HasSuffix(f.Name.Name, "_test") {
+		pkgPath += "_test"
+	}
+	return pkgPath
+}
+
+// modulePath returns the module path declared in root/go.mod, or an empty string.
+func modulePath(root string) string {
+	data, err := os.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return ""
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+
+	return ""
+}
+
+// importPath returns the import path of the package in dir.
+func importPath(modPath, root, dir string) string {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		rel = ""
+	}
+	rel = filepath.ToSlash(rel)
+
+	switch {
+	case modPath == "":
+		if rel == "" {
+			return "."
+		}
+		return rel
+	case rel == "":
+		return modPath
+	default:
+		return modPath + "/" + rel
+	}
+}
+
+// extractor holds the state needed while converting a parsed package into a graph.
+type extractor struct {
+	fset        *token.FileSet
+	graph       *Graph
+	currentFunc *Node
+	withCFG     bool
+	info        *types.Info // type information of the extracted files, possibly partial
+
+	// pkgPath is the import path of the extracted package. When set, the package node
+	// is named after it, so that several packages can be extracted into the same graph.
+	pkgPath       string
+	pkgName       string
+	pkgNode       *Node
+	qualification Qualification     // how the functions of the package are named
+	imports       map[string]string // import paths by the name they are used as in the current file
+	file          *ast.File         // file being extracted
+
+	funcs    map[string]*ast.FuncDecl     // top-level functions by name, to resolve parameters
+	methods  map[string]*ast.FuncDecl     // methods by node name, to resolve parameters
+	literals map[*ast.FuncLit]*Node       // function literal nodes
+	litVars  map[*ast.Object]*ast.FuncLit // variables holding a function literal, to resolve their calls
+	objects  map[*ast.Object]*Node        // variable and constant nodes by the object their identifiers resolve to
+	packages map[string]*Node             // package nodes by import path
+
+	spawned   map[*ast.CallExpr]bool // calls of go statements
+	deferred  map[*ast.CallExpr]bool // calls of defer statements
+	selected  map[ast.Node]bool      // channel operations of select cases
+	channels  map[string]*Node       // channel nodes named after an expression other than a variable
+	mutexes   map[string]*Node       // mutex nodes by the expression they are named after
+	mutexVars map[*types.Var]*Node   // mutex nodes by the variable or field holding them, shared by the packages of an extraction
+
+	callEdges map[*ast.CallExpr]*Edge // edges extracted from calls, to annotate them
+
+	constraints map[string]*Node             // constraint nodes named after their expression
+	fields      map[*types.Var]*Node         // field nodes by field, shared by the packages of an extraction
+	globals     map[*types.Var]*Node         // package-level variable nodes, shared by the packages of an extraction
+	tree        map[string]*parsedPackage    // packages of the extraction by import path
+	writes      map[*ast.SelectorExpr]string // fields written, by the operation writing them
+	instances   bool                         // whether instantiations of generic functions are nodes of their own
+
+	plugins     []Plugin
+	pluginNodes map[pluginNodeKey]*Node // nodes created by plugins, shared by the packages of an extraction
+
+	// track, when set, is called with the nodes and edges extracted from each file
+	track func(f *ast.File, nodes []*Node, edges []*Edge)
+}
+
+func newExtractor(fset *token.FileSet, graph *Graph, withCFG bool) *extractor {
+	return &extractor{
+		fset:        fset,
+		graph:       graph,
+		currentFunc: NewNode(Unknown, ""),
+		withCFG:     withCFG,
+		imports:     make(map[string]string),
+		funcs:       make(map[string]*ast.FuncDecl),
+		methods:     make(map[string]*ast.FuncDecl),
+		literals:    make(map[*ast.FuncLit]*Node),
+		litVars:     make(map[*ast.Object]*ast.FuncLit),
+		objects:     make(map[*ast.Object]*Node),
+		packages:    make(map[string]*Node),
+		spawned:     make(map[*ast.CallExpr]bool),
+		deferred:    make(map[*ast.CallExpr]bool),
+		selected:    make(map[ast.Node]bool),
+		channels:    make(map[string]*Node),
+		mutexes:     make(map[string]*Node),
+		mutexVars:   make(map[*types.Var]*Node),
+		callEdges:   make(map[*ast.CallExpr]*Edge),
+		constraints: make(map[string]*Node),
+		fields:      make(map[*types.Var]*Node),
+		globals:     make(map[*types.Var]*Node),
+		writes:      make(map[*ast.SelectorExpr]string),
+		pluginNodes: make(map[pluginNodeKey]*Node),
+	}
+}
+
+// extract adds the given files, which must belong to the same package, to the graph.
+func (e *extractor) extract(files ...*ast.File) {
+	if len(files) == 0 {
+		return
+	}
+
+	// the package declares every top-level member of its files
+	mark := e.mark()
+	e.pkgName = files[0].Name.Name
+	var pkgNode *Node
+	if e.pkgPath != "" {
+		pkgNode = e.packageNode(e.pkgPath)
+		pkgNode.SetAttr("name", files[0].Name.Name)
+	} else {
+		pkgNode = e.packageNode(files[0].Name.Name)
+		pkgNode.SetAttr("pos", e.fset.Position(files[0].Name.Pos()).String())
+	}
+	e.pkgNode = pkgNode
+	e.contribute(files[0], mark)
+
+	// record the function declarations first, so that arguments passed to a function
+	// declared later in the package still reach its parameters.
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			switch {
+			case !ok:
+			case fd.Recv == nil:
+				e.funcs[fd.Name.Name] = fd
+			default:
+				e.methods[e.declName(fd)] = fd
+			}
+		}
+	}
+
+	// package-level declarations are extracted before the functions, so that functions
+	// find the nodes of package-level variables regardless of the declaration order.
+	for _, f := range files {
+		mark := e.mark()
+		e.file = f
+		e.currentFunc = pkgNode
+		e.fileImports(pkgNode, f)
+		for _, decl := range f.Decls {
+			if _, ok := decl.(*ast.GenDecl); ok {
+				e.inspect(decl)
+			}
+		}
+		e.contribute(f, mark)
+	}
+
+	for _, f := range files {
+		mark := e.mark()
+		e.file = f
+		e.imports = make(map[string]string)
+		for _, spec := range f.Imports {
+			e.addImportName(spec)
+		}
+
+		for _, decl := range f.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok {
+				e.currentFunc = pkgNode
+				e.inspect(decl)
+				e.errorFlow(fd)
+			}
+		}
+		e.contribute(f, mark)
+	}
+	e.currentFunc = pkgNode
+}
+
+// graphMark marks the end of the nodes and edges of a graph at some point of an extraction.
+type graphMark struct {
+	nodes, edges int
+}
+
+func (e *extractor) mark() graphMark {
+	return graphMark{len(e.graph.Nodes), len(e.graph.Edges)}
+}
+
+// contribute reports the nodes and edges added since mark as extracted from f.
+func (e *extractor) contribute(f *ast.File, mark graphMark) {
+	if e.track != nil {
+		e.track(f, e.graph.Nodes[mark.nodes:], e.graph.Edges[mark.edges:])
+	}
+}
+
+func (e *extractor) inspect(node ast.Node) {
+	// function literals become the current function while their body is inspected
+	var stack []ast.Node
+	var enclosing []*Node
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == nil {
+			if _, ok := stack[len(stack)-1].(*ast.FuncLit); ok {
+				e.currentFunc = enclosing[len(enclosing)-1]
+				enclosing = enclosing[:len(enclosing)-1]
 			}
+			stack = stack[:len(stack)-1]
+			return true
+		}
 
-		default:
-			// do nothing
+		if !e.visit(n) {
+			return false
+		}
+		e.runPlugins(n)
+		if lit, ok := n.(*ast.FuncLit); ok {
+			enclosing = append(enclosing, e.currentFunc)
+			e.enterFuncLit(lit)
 		}
+		stack = append(stack, n)
 
 		return true
 	})
+}
 
-	return graph, nil
+// visit adds the nodes and edges extracted from n to the graph, and reports
+// whether the children of n should be visited.
+func (e *extractor) visit(n ast.Node) bool {
+	graph := e.graph
+
+	switch x := n.(type) {
+	case *ast.FuncDecl:
+		// create function node and add it to graph
+		funcNode := e.funcNode(e.declName(x))
+		funcNode.SetAttr("pos", e.fset.Position(x.Name.Pos()).String())
+		funcNode.SetAttr("end", e.fset.Position(x.End()).String())
+		funcNode.SetAttr("pkg", e.currentFunc.Name)
+		if kind := e.testKind(x); kind != "" {
+			funcNode.SetType(TestFunc)
+			funcNode.SetAttr("kind", kind)
+		}
+		graph.AddEdge(e.currentFunc, funcNode, Declares)
+
+		// set current function
+		e.currentFunc = funcNode
+
+		e.declareFields(x.Recv, "receiver")
+		e.declareTypeParams(funcNode, x.Type.TypeParams)
+		e.declareFields(x.Type.Params, "param")
+
+		// named results are returned whenever the function returns
+		for _, result := range e.declareFields(x.Type.Results, "result") {
+			e.addFlow(result, funcNode, Return, x.Type.Results.Pos())
+		}
+
+		if e.withCFG {
+			buildCFG(graph, e.fset, x, funcNode, e.calleeName)
+		}
+
+	case *ast.GenDecl:
+		kind := "global"
+		if e.inFunction() {
+			kind = "local"
+		}
+
+		for _, spec := range x.Specs {
+			switch spec := spec.(type) {
+			case *ast.ValueSpec:
+				if x.Tok == token.CONST {
+					// constant declaration
+					for _, name := range spec.Names {
+						e.declareAs(name, Const, kind)
+					}
+					continue
+				}
+
+				// variable declaration
+				for i, name := range spec.Names {
+					var value ast.Expr
+					if i < len(spec.Values) {
+						value = spec.Values[i]
+					}
+					markChannel(e.declare(name, kind), spec.Type, value)
+				}
+				e.assign(exprList(spec.Names), spec.Values)
+
+			case *ast.TypeSpec:
+				e.declareType(spec)
+			}
+		}
+
+	case *ast.AssignStmt:
+		// short variable declarations, including the binding of a type switch
+		if x.Tok == token.DEFINE {
+			for i, l := range x.Lhs {
+				if ident, ok := l.(*ast.Ident); ok && ident.Obj != nil && ident.Obj.Decl == x {
+					var value ast.Expr
+					if len(x.Lhs) == len(x.Rhs) {
+						value = x.Rhs[i]
+					}
+					markChannel(e.declare(ident, "local"), nil, value)
+				}
+			}
+		}
+		e.written(x.Lhs, "assign")
+		e.assign(x.Lhs, x.Rhs)
+
+	case *ast.IncDecStmt:
+		op := "inc"
+		if x.Tok == token.DEC {
+			op = "dec"
+		}
+		e.written([]ast.Expr{x.X}, op)
+
+	case *ast.RangeStmt:
+		for _, target := range []ast.Expr{x.Key, x.Value} {
+			if target == nil {
+				continue
+			}
+			if ident, ok := target.(*ast.Ident); ok && x.Tok == token.DEFINE {
+				e.declare(ident, "range")
+			}
+			e.assign([]ast.Expr{target}, []ast.Expr{x.X})
+		}
+		e.rangeChannel(x)
+
+	case *ast.GoStmt:
+		e.spawn(x)
+
+	case *ast.DeferStmt:
+		e.deferred[x.Call] = true
+		e.deferRecover(x)
+
+	case *ast.CommClause:
+		e.selectCase(x)
+
+	case *ast.SendStmt:
+		e.send(x)
+
+	case *ast.UnaryExpr:
+		e.receive(x)
+		e.addressTaken(x)
+
+	case *ast.SelectorExpr:
+		e.fieldAccess(x)
+
+	case *ast.CompositeLit:
+		e.fieldInits(x)
+
+	case *ast.ReturnStmt:
+		for _, result := range x.Results {
+			e.flow(result, e.currentFunc, Return)
+		}
+
+	case *ast.Ident:
+		e.checkVarUsage(x)
+
+	case *ast.CallExpr:
+		e.lockCall(x)
+		if err := e.processCall(x); err != nil {
+			e.diagnose(x.Pos(), SeverityWarning, DiagnosticUnsupported, "error processing call: %s", err)
+			return true
+		}
+
+		// handling variables passed as parameters in function calls
+		e.passArgs(x)
+
+	default:
+		// do nothing
+	}
+
+	return true
 }
 
-func checkVarUsage(currFunc *Node, graph *Graph, ident *ast.Ident) {
-	if ident.Obj != nil && ident.Obj.Kind == ast.Var {
+// checkVarUsage adds a Uses edge from the current function to the variable or constant
+// ident refers to. The identifier naming a variable in its declaration is not a usage.
+func (e *extractor) checkVarUsage(ident *ast.Ident) {
+	if ident.Obj == nil {
+		// package-level variables of other files and packages
+		if global := e.globalNode(ident); global != nil {
+			edge := e.graph.AddEdge(e.currentFunc, global, Uses)
+			edge.SetAttr("pos", e.fset.Position(ident.Pos()).String())
+		}
+		return
+	}
+	if ident.Pos() == ident.Obj.Pos() {
+		return
+	}
+
+	if ident.Obj.Kind == ast.Var || ident.Obj.Kind == ast.Con {
 		// check for variable usage in the current function
-		varNode, exists := graph.NodeMap[ident.Name]
+		varNode, exists := e.objects[ident.Obj]
 		if exists {
-			graph.AddEdge(currFunc, varNode, Uses)
+			edge := e.graph.AddEdge(e.currentFunc, varNode, Uses)
+			edge.SetAttr("pos", e.fset.Position(ident.Pos()).String())
 		}
 	}
 }
 
 // processCall extracts node information from the generated AST and
 // and converts it into a graph structure.
-func processCall(x *ast.CallExpr, graph *Graph, currentFunc *Node) error {
-	var funcName string
+func (e *extractor) processCall(x *ast.CallExpr) error {
+	callFunc, _, err := e.callee(x.Fun)
+	if errors.Is(err, errConversion) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if e.isDynamicCallee(x.Fun) {
+		e.diagnose(x.Pos(), SeverityInfo, DiagnosticDynamic, "callee of %s named after its expression", callFunc.Name)
+	}
+
+	// calls of generic functions instantiate them
+	generic := callFunc
+	inst, isInstance := e.instance(x.Fun)
+	if isInstance && e.instances {
+		callFunc = e.instanceNode(generic, inst)
+	}
+
+	// Create an edge from the current function to the called function
+	relation := Call
+	switch {
+	case e.spawned[x]:
+		relation = Spawns
+	case e.deferred[x]:
+		relation = Defers
+	}
+	edge := e.graph.AddEdge(e.currentFunc, callFunc, relation)
+	edge.SetAttr("pos", e.fset.Position(x.Pos()).String())
+	if recv := e.receiverType(x.Fun); recv != "" {
+		edge.SetAttr("recv", recv)
+	}
+	e.callEdges[x] = edge
+
+	// calls known to panic keep their Call, Defers or Spawns edge, followed like any other
+	if e.panics(x.Fun, callFunc) {
+		panics := e.graph.AddEdge(e.currentFunc, callFunc, Panics)
+		panics.SetAttr("pos", e.fset.Position(x.Pos()).String())
+		if exits(callFunc) {
+			panics.SetAttr("exit", "true")
+		}
+	}
+
+	if isInstance && !e.instances {
+		instantiates := e.graph.AddEdge(e.currentFunc, generic, Instantiates)
+		instantiates.SetAttr("types", typeArgs(inst))
+		instantiates.SetAttr("pos", e.fset.Position(x.Pos()).String())
+	}
+
+	return nil
+}
+
+// receiverType returns the receiver type of the method called through fun, e.g. "*sql.DB",
+// or an empty string if fun is not a method or its type is unknown. Promoted methods have
+// the receiver type of the method declaration, that is of the embedded field.
+func (e *extractor) receiverType(fun ast.Expr) string {
+	for {
+		paren, ok := fun.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		fun = paren.X
+	}
+	sel, ok := fun.(*ast.SelectorExpr)
+	if !ok {
+		return ""
+	}
+	selection, ok := e.info.Selections[sel]
+	if !ok || selection.Kind() != types.MethodVal {
+		return ""
+	}
+	sig, ok := selection.Obj().Type().(*types.Signature)
+	if !ok || sig.Recv() == nil {
+		return ""
+	}
+	return typeString(sig.Recv().Type())
+}
+
+// errConversion is returned when resolving the callee of a type conversion.
+var errConversion = errors.New("type conversion is not a call")
 
-	switch call := x.Fun.(type) {
+// calleeName returns the name of the function called through fun.
+//
+// Functions and methods called through an identifier or a selector are named after
+// them, e.g. "f" or "s.Close"; see resolveCallee for the methods resolved to their
+// declaration. Any other callee, such as a method called on the result
+// of a call or a function held in a map, is named after its expression, e.g. "f().Close"
+// or "handlers[name]".
+func calleeName(fun ast.Expr) (string, error) {
+	switch call := fun.(type) {
 	case *ast.Ident:
-		funcName = call.Name
+		return call.Name, nil
 	case *ast.SelectorExpr:
 		// handle method or package-level function calls
 		if ident, ok := call.X.(*ast.Ident); ok {
-			funcName = fmt.Sprintf("%s.%s", ident.Name, call.Sel.Name)
-		} else {
-			return fmt.Errorf("unhandled call type: %T", call.X)
+			return fmt.Sprintf("%s.%s", ident.Name, call.Sel.Name), nil
 		}
+		return types.ExprString(call), nil
+	case *ast.ParenExpr:
+		return calleeName(call.X)
+	case *ast.ArrayType, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType, *ast.StructType:
+		return "", errConversion
+	case *ast.BadExpr:
+		return "", fmt.Errorf("unknown call type: %T", fun)
 	default:
-		return fmt.Errorf("unknown call type: %T", x.Fun)
+		return types.ExprString(call), nil
 	}
+}
 
-	callFunc, exists := graph.NodeMap[funcName]
-	if !exists {
-		callFunc = NewNode(Func, funcName)
-		graph.AddNode(callFunc)
+// isDynamicCallee reports whether the callee fun can only be named after its expression,
+// rather than after a function or a method declared in the extraction.
+func (e *extractor) isDynamicCallee(fun ast.Expr) bool {
+	switch call := fun.(type) {
+	case *ast.Ident, *ast.FuncLit:
+		return false
+	case *ast.ParenExpr:
+		return e.isDynamicCallee(call.X)
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		return e.genericFunc(call) == nil
+	case *ast.SelectorExpr:
+		if _, method := e.selectedMethod(call); method != "" {
+			return false
+		}
+		for x := call.X; ; {
+			switch inner := x.(type) {
+			case *ast.Ident:
+				return false
+			case *ast.SelectorExpr:
+				x = inner.X
+			default:
+				return true
+			}
+		}
+	}
+	return true
+}
+
+// calleeName returns the name of the node of the function called through fun. Functions
+// of the extracted package are qualified like their declaration, and functions of
+// imported packages are qualified with the import path when extracting a whole package.
+func (e *extractor) calleeName(fun ast.Expr) (string, error) {
+	name, _, _, err := e.resolveCallee(fun)
+	return name, err
+}
+
+// resolveCallee resolves the function called through fun to its node name, the import
+// path of the package declaring it when known, and its signature when it is declared in
+// the extracted package. Methods declared in the extraction resolve to the node of their
+// declaration, e.g. "Server.Close", and any other method to its receiver expression.
+// Instantiations of generic functions resolve to the generic function, and type
+// conversions fail with errConversion.
+func (e *extractor) resolveCallee(fun ast.Expr) (string, string, *ast.FuncType, error) {
+	if lit := e.calledLiteral(fun); lit != nil {
+		return e.funcLitNode(lit).Name, e.pkgNode.Name, lit.Type, nil
 	}
 
-	// Create an edge from the current function to the called function
-	graph.AddEdge(currentFunc, callFunc, Call)
+	for {
+		paren, ok := fun.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		fun = paren.X
+	}
+	if generic := e.genericFunc(fun); generic != nil {
+		fun = generic
+	}
+	if tv, ok := e.info.Types[fun]; ok && tv.IsType() {
+		return "", "", nil, errConversion
+	}
+
+	name, err := calleeName(fun)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	switch call := fun.(type) {
+	case *ast.Ident:
+		// identifiers declared in another file of the package are not resolved by the parser
+		if call.Obj == nil || call.Obj.Kind == ast.Fun {
+			if decl, ok := e.funcs[call.Name]; ok {
+				return e.qualify(call.Name), e.pkgNode.Name, decl.Type, nil
+			}
+		}
+	case *ast.SelectorExpr:
+		// methods declared in the extraction, called on a value or as a method expression
+		if fn, method := e.selectedMethod(call); method != "" {
+			if e.isExtracted(fn.Pkg()) {
+				var sig *ast.FuncType
+				if decl, ok := e.methods[method]; ok {
+					sig = decl.Type
+				}
+				return method, e.pkgNode.Name, sig, nil
+			}
+			return method, fn.Pkg().Path(), nil, nil
+		}
+
+		// package members, or members of a package-level variable such as http.DefaultClient.Do
+		root := call.X
+		for {
+			sel, ok := root.(*ast.SelectorExpr)
+			if !ok {
+				break
+			}
+			root = sel.X
+		}
+		ident, ok := root.(*ast.Ident)
+		if !ok {
+			break
+		}
+		if path, ok := e.imports[ident.Name]; ok && ident.Obj == nil {
+			if e.qualification == QualifyPath {
+				name = path + strings.TrimPrefix(name, ident.Name)
+			}
+			return name, path, nil, nil
+		}
+	}
+
+	return name, "", nil, nil
+}
+
+// genericFunc returns the generic function instantiated by fun, as in f[int] or
+// pkg.F[K, V], or nil if fun is not an instantiation.
+func (e *extractor) genericFunc(fun ast.Expr) ast.Expr {
+	var x ast.Expr
+	switch index := fun.(type) {
+	case *ast.IndexExpr:
+		x = index.X
+	case *ast.IndexListExpr:
+		x = index.X
+	default:
+		return nil
+	}
+
+	if tv, ok := e.info.Types[x]; ok {
+		if _, isFunc := tv.Type.(*types.Signature); isFunc {
+			return x
+		}
+		return nil
+	}
+
+	// without type information, only functions of the package are known
+	if ident, ok := x.(*ast.Ident); ok {
+		if _, declared := e.funcs[ident.Name]; declared {
+			return x
+		}
+	}
+	return nil
+}
+
+// callee returns the node of the function called through fun, and its signature
+// if it is declared in the extracted package.
+func (e *extractor) callee(fun ast.Expr) (*Node, *ast.FuncType, error) {
+	if lit := e.calledLiteral(fun); lit != nil {
+		return e.funcLitNode(lit), lit.Type, nil
+	}
 
+	name, pkg, sig, err := e.resolveCallee(fun)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	node := e.funcNode(name)
+	if pkg != "" {
+		node.SetAttr("pkg", pkg)
+	}
+
+	return node, sig, nil
+}
+
+// calledLiteral returns the function literal called through fun, either directly as in
+// func() { ... }(), or through a variable the literal was assigned to.
+func (e *extractor) calledLiteral(fun ast.Expr) *ast.FuncLit {
+	switch x := fun.(type) {
+	case *ast.FuncLit:
+		return x
+	case *ast.ParenExpr:
+		return e.calledLiteral(x.X)
+	case *ast.Ident:
+		if x.Obj != nil {
+			return e.litVars[x.Obj]
+		}
+	}
 	return nil
 }
+
+// funcLitNode returns the node of a function literal, named after the enclosing
+// function and the position of the literal, e.g. "main.func@12:9".
+func (e *extractor) funcLitNode(lit *ast.FuncLit) *Node {
+	if node, exists := e.literals[lit]; exists {
+		return node
+	}
+
+	pos := e.fset.Position(lit.Pos())
+	node := NewNode(FuncLit, fmt.Sprintf("%s.func@%d:%d", e.currentFunc.Name, pos.Line, pos.Column))
+	node.SetAttr("pos", pos.String())
+	node.SetAttr("end", e.fset.Position(lit.End()).String())
+	node.SetAttr("pkg", e.pkgNode.Name)
+	e.graph.AddNode(node)
+	e.literals[lit] = node
+
+	return node
+}
+
+// enterFuncLit makes lit the current function: the enclosing function defines it, and
+// it captures the local variables of the enclosing functions it refers to.
+func (e *extractor) enterFuncLit(lit *ast.FuncLit) {
+	litNode := e.funcLitNode(lit)
+	e.graph.AddEdge(e.currentFunc, litNode, Defines)
+
+	captured := make(map[*ast.Object]bool)
+	ast.Inspect(lit.Body, func(n ast.Node) bool {
+		ident, ok := n.(*ast.Ident)
+		if !ok || ident.Obj == nil || captured[ident.Obj] {
+			return true
+		}
+
+		// variables declared outside of the literal, except package-level ones
+		varNode, exists := e.objects[ident.Obj]
+		declPos := ident.Obj.Pos()
+		if exists && isVariable(varNode) && varNode.Attr("kind") != "global" && (declPos < lit.Pos() || declPos >= lit.End()) {
+			captured[ident.Obj] = true
+			edge := e.graph.AddEdge(litNode, varNode, Captures)
+			edge.SetAttr("pos", e.fset.Position(ident.Pos()).String())
+		}
+		return true
+	})
+
+	e.currentFunc = litNode
+	e.declareFields(lit.Type.Params, "param")
+	for _, result := range e.declareFields(lit.Type.Results, "result") {
+		e.addFlow(result, litNode, Return, lit.Type.Results.Pos())
+	}
+}
+
+// inFunction reports whether the current scope is a function rather than a package.
+func (e *extractor) inFunction() bool {
+	return isFunction(e.currentFunc) || e.currentFunc.Type == FuncLit
+}
+
+// declName returns the node name of the function or method declared by decl. Methods are
+// named after the type of their receiver, e.g. "Server.Close", so that the methods of
+// different types sharing a name are kept apart.
+func (e *extractor) declName(decl *ast.FuncDecl) string {
+	if decl.Recv != nil && len(decl.Recv.List) > 0 {
+		if recv := embeddedName(decl.Recv.List[0].Type); recv != nil {
+			return e.qualify(recv.Name + "." + decl.Name.Name)
+		}
+	}
+	return e.qualify(decl.Name.Name)
+}
+
+// selectedMethod returns the method selected by sel and its node name, or an empty name
+// if sel does not select a method declared in the extraction; see methodName.
+func (e *extractor) selectedMethod(sel *ast.SelectorExpr) (*types.Func, string) {
+	selection, ok := e.info.Selections[sel]
+	if !ok || selection.Kind() == types.FieldVal {
+		return nil, ""
+	}
+	fn, ok := selection.Obj().(*types.Func)
+	if !ok {
+		return nil, ""
+	}
+	return fn, e.methodName(fn)
+}
+
+// methodName returns the node name of the method fn, named like its declaration, or an
+// empty string if fn is not declared in the extraction, or is the method of an interface.
+func (e *extractor) methodName(fn *types.Func) string {
+	sig, ok := fn.Type().(*types.Signature)
+	if !ok || sig.Recv() == nil || fn.Pkg() == nil {
+		return ""
+	}
+	if _, extracted := e.tree[fn.Pkg().Path()]; !extracted && !e.isExtracted(fn.Pkg()) {
+		return ""
+	}
+
+	t := sig.Recv().Type()
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := t.(*types.Named)
+	if !ok || types.IsInterface(named) {
+		return ""
+	}
+	return e.objectName(named.Origin().Obj()) + "." + fn.Name()
+}
+
+// qualify returns the node name of a top-level function of the extracted package.
+func (e *extractor) qualify(name string) string {
+	switch {
+	case e.qualification == QualifyPath && e.pkgPath != "":
+		return e.pkgPath + "." + name
+	case e.qualification == QualifyPath || e.qualification == QualifyPackage:
+		return e.pkgName + "." + name
+	default:
+		return name
+	}
+}
+
+// funcNode returns the function node registered under name, creating it if needed.
+func (e *extractor) funcNode(name string) *Node {
+	node, exists := e.graph.NodeMap[name]
+	if !exists {
+		node = NewNode(Func, name)
+		e.graph.AddNode(node)
+	}
+	return node
+}
+
+// varNode returns the node of the variable ident refers to, creating it on its first use,
+// or nil if the parser did not resolve ident.
+//
+// Variables are identified by the object of their declaration rather than by name, so
+// that two variables sharing a name in different scopes are kept apart.
+func (e *extractor) varNode(ident *ast.Ident) *Node {
+	if ident.Obj == nil {
+		return nil
+	}
+	return e.objectNode(ident, Var)
+}
+
+// objectNode returns the node of type t for the object ident refers to, creating it if needed.
+func (e *extractor) objectNode(ident *ast.Ident, t NodeType) *Node {
+	if ident.Obj == nil {
+		node := NewNode(t, ident.Name)
+		e.graph.Nodes = append(e.graph.Nodes, node)
+		return node
+	}
+
+	if node, exists := e.objects[ident.Obj]; exists {
+		return node
+	}
+
+	node := NewNode(t, ident.Name)
+	e.graph.Nodes = append(e.graph.Nodes, node)
+	e.objects[ident.Obj] = node
+
+	return node
+}
+
+// packageNode returns the node of the package with the given path, creating it if needed.
+//
+// Like variables, packages are kept out of the node map: a package is commonly named
+// after one of its functions, starting with main.
+func (e *extractor) packageNode(path string) *Node {
+	if node, exists := e.packages[path]; exists {
+		return node
+	}
+
+	node := NewNode(Package, path)
+	e.graph.Nodes = append(e.graph.Nodes, node)
+	e.packages[path] = node
+
+	return node
+}
+
+// fileImports adds an Imports edge from pkgNode to every package imported by f, and
+// records the names the imported packages are used as in f. Renamed, dot and blank
+// imports record the name they are imported as in the "alias" attribute of the edge.
+func (e *extractor) fileImports(pkgNode *Node, f *ast.File) {
+	e.imports = make(map[string]string)
+
+	for _, spec := range f.Imports {
+		path := e.addImportName(spec)
+		if path == "" {
+			continue
+		}
+
+		edge := e.graph.AddEdge(pkgNode, e.packageNode(path), Imports)
+		edge.SetAttr("pos", e.fset.Position(spec.Pos()).String())
+		if spec.Name != nil {
+			edge.SetAttr("alias", spec.Name.Name)
+		}
+	}
+}
+
+// addImportName records the name the package imported by spec is used as, and returns
+// its import path. Without an alias, the package is assumed to be named after the last
+// element of its path, ignoring a major version suffix.
+func (e *extractor) addImportName(spec *ast.ImportSpec) string {
+	path, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return ""
+	}
+
+	name := path[strings.LastIndex(path, "/")+1:]
+	if strings.HasPrefix(name, "v") && strings.Contains(path, "/") {
+		if _, err := strconv.Atoi(name[1:]); err == nil {
+			trimmed := strings.TrimSuffix(path, "/"+name)
+			name = trimmed[strings.LastIndex(trimmed, "/")+1:]
+		}
+	}
+	if spec.Name != nil {
+		name = spec.Name.Name
+	}
+	e.imports[name] = path
+
+	return path
+}
+
+// declareType adds the type declared by spec and a Declares edge from the current scope.
+func (e *extractor) declareType(spec *ast.TypeSpec) {
+	typeNode := e.objectNode(spec.Name, TypeDecl)
+	typeNode.SetAttr("pos", e.fset.Position(spec.Name.Pos()).String())
+	if e.inFunction() {
+		typeNode.SetAttr("scope", e.currentFunc.Name)
+	}
+	e.graph.AddEdge(e.currentFunc, typeNode, Declares)
+	e.declareTypeParams(typeNode, spec.TypeParams)
+	e.declareStructFields(typeNode, spec)
+}
+
+// declare adds the variable bound by ident to the graph, and a Declares edge from the
+// current function. kind tells how the variable is bound: "global", "local", "param",
+// "result", "receiver" or "range". Local variables also record the function declaring
+// them in the "scope" attribute. When known, the type of the variable is recorded in the
+// "type" attribute, and variables holding an error are marked with an "error" attribute.
+func (e *extractor) declare(ident *ast.Ident, kind string) *Node {
+	return e.declareAs(ident, Var, kind)
+}
+
+// declareAs declares ident like declare, with a node of type t.
+func (e *extractor) declareAs(ident *ast.Ident, t NodeType, kind string) *Node {
+	if ident.Name == "_" {
+		return nil
+	}
+
+	// package-level variables used before their declaration are adopted
+	v, isVar := e.info.Defs[ident].(*types.Var)
+	if isVar && kind == "global" && ident.Obj != nil {
+		if node, exists := e.globals[v]; exists {
+			e.objects[ident.Obj] = node
+		}
+	}
+
+	node := e.objectNode(ident, t)
+	node.SetAttr("kind", kind)
+	if isVar && kind == "global" {
+		e.globals[v] = node
+	}
+	node.SetAttr("pos", e.fset.Position(ident.Pos()).String())
+	if obj := e.info.Defs[ident]; obj != nil && t == Var {
+		node.SetAttr("type", typeString(obj.Type()))
+		if isError(obj.Type()) {
+			node.SetAttr("error", "true")
+		}
+	}
+	if e.inFunction() {
+		node.SetAttr("scope", e.currentFunc.Name)
+	}
+	e.graph.AddEdge(e.currentFunc, node, Declares)
+
+	return node
+}
+
+// declareFields declares the named parameters, results or receiver of a function.
+func (e *extractor) declareFields(fields *ast.FieldList, kind string) []*Node {
+	if fields == nil {
+		return nil
+	}
+
+	var nodes []*Node
+	for _, field := range fields.List {
+		for _, name := range field.Names {
+			if varNode := e.declare(name, kind); varNode != nil {
+				markChannel(varNode, field.Type, nil)
+				nodes = append(nodes, varNode)
+			}
+		}
+	}
+
+	return nodes
+}
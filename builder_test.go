@@ -22,8 +22,8 @@ func TestExtractGraphFromAST(t *testing.T) {
 package main
 func main() {
 }`,
-			expectedNodeCount: 1, // main
-			expectedEdgeCount: 0,
+			expectedNodeCount: 2, // package main, main
+			expectedEdgeCount: 1, // package main -> main (Declares)
 		},
 		{
 			name: "main and println",
@@ -33,8 +33,8 @@ import "fmt"
 func main() {
 	fmt.Println("Hello, World!")
 }`,
-			expectedNodeCount: 2, // main, fmt.Println
-			expectedEdgeCount: 1, // main -> fmt.Println
+			expectedNodeCount: 4, // package main, package fmt, main, fmt.Println
+			expectedEdgeCount: 3, // package main -> fmt (Imports), package main -> main (Declares), main -> fmt.Println
 		},
 		{
 			name: "simple function",
@@ -44,8 +44,8 @@ import "fmt"
 func main() {
 	fmt.Println("Hello, World!")
 }`,
-			expectedNodeCount: 2, // main, fmt.Println
-			expectedEdgeCount: 1, // main -> fmt.Println
+			expectedNodeCount: 4, // package main, package fmt, main, fmt.Println
+			expectedEdgeCount: 3, // package main -> fmt (Imports), package main -> main (Declares), main -> fmt.Println
 		},
 		{
 			name: "two functions",
@@ -59,8 +59,8 @@ func printMore(msg string) {
 	println(msg)
 }
 `,
-			expectedNodeCount: 4,
-			expectedEdgeCount: 2, // main -> printMore, printMore -> println
+			expectedNodeCount: 5, // package main, main, printMore, println, msg
+			expectedEdgeCount: 7, // package main -> main, printMore (Declares), main -> printMore, printMore -> println, printMore -> msg (Declares, Uses), msg -> println (PassesTo)
 		},
 		{
 			name: "only main function",
@@ -68,8 +68,8 @@ func printMore(msg string) {
 package main
 func main() {
 }`,
-			expectedNodeCount: 1, // main
-			expectedEdgeCount: 0,
+			expectedNodeCount: 2, // package main, main
+			expectedEdgeCount: 1, // package main -> main (Declares)
 		},
 		{
 			name: "main and println",
@@ -79,8 +79,8 @@ import "fmt"
 func main() {
 	fmt.Println("Hello, World!")
 }`,
-			expectedNodeCount: 2, // main, fmt.Println
-			expectedEdgeCount: 1, // main -> fmt.Println
+			expectedNodeCount: 4, // package main, package fmt, main, fmt.Println
+			expectedEdgeCount: 3, // package main -> fmt (Imports), package main -> main (Declares), main -> fmt.Println
 		},
 		{
 			name: "function with return value",
@@ -96,8 +96,8 @@ func main() {
 	println(str)
 }
 `,
-			expectedNodeCount: 4, // main, getString, str, println
-			expectedEdgeCount: 2, // main -> getString, getString -> "Hello, World!"
+			expectedNodeCount: 5, // package main, main, getString, str, println
+			expectedEdgeCount: 8, // package main -> getString, main (Declares), main -> getString, main -> println, main -> str (Declares, Uses), getString -> str (Assigns), str -> println (PassesTo)
 		},
 	}
 
@@ -131,8 +131,8 @@ func main() {
 	x = 5
 	println(x)
 }`,
-			expectedNodeCount: 3, // main, x, println
-			expectedEdgeCount: 2, // main -> x (Declares), main -> x (Uses)
+			expectedNodeCount: 4, // package main, main, x, println
+			expectedEdgeCount: 6, // package main -> main (Declares), main -> x (Declares), main -> x (Uses) x2, main -> println, x -> println (PassesTo)
 		},
 		{
 			name: "variable passed to function",
@@ -145,8 +145,8 @@ func main() {
 func print(msg string) {
 	println(msg)
 }`,
-			expectedNodeCount: 5, // main, message, print, msg, println
-			expectedEdgeCount: 3, // main -> message (Declares), main -> print (Calls), print -> msg (PassesTo)
+			expectedNodeCount: 6,  // package main, main, message, print, msg, println
+			expectedEdgeCount: 10, // package main -> main, print (Declares), main -> message (Declares, Uses), main -> print, message -> msg (PassesTo), print -> msg (Declares, Uses), print -> println, msg -> println (PassesTo)
 		},
 		{
 			name: "global variable usage",
@@ -157,8 +157,8 @@ func main() {
 	globalVar = 10
 	println(globalVar)
 }`,
-			expectedNodeCount: 3, // globalVar, main, println
-			expectedEdgeCount: 2, // main -> globalVar (Uses), main -> globalVar (Declares)
+			expectedNodeCount: 4, // package main, globalVar, main, println
+			expectedEdgeCount: 7, // package main -> globalVar, main (Declares), main -> globalVar (Uses) x2, main -> globalVar (Writes), main -> println, globalVar -> println (PassesTo)
 		},
 		{
 			name: "No main, only variable declaration",
@@ -166,8 +166,8 @@ func main() {
 package main
 var x int
 `,
-			expectedNodeCount: 1, // x
-			expectedEdgeCount: 1, // main -> x (Declares)
+			expectedNodeCount: 2, // package main, x
+			expectedEdgeCount: 1, // package main -> x (Declares)
 		},
 	}
 
@@ -186,3 +186,326 @@ var x int
 		})
 	}
 }
+
+func TestExtractGraphFromAST_Bindings(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+
+var counter int
+
+type Server struct{}
+
+func (s *Server) Handle(req interface{}, items []string) (n int, err error) {
+	count := len(items)
+	for i, item := range items {
+		println(i, item)
+	}
+	var total int
+	switch v := req.(type) {
+	case string:
+		println(v)
+	}
+	_ = total
+	return count, nil
+}
+`
+
+	graph, err := ExtractGraphFromAST(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	expected := map[string]string{
+		"counter": "global",
+		"s":       "receiver",
+		"req":     "param",
+		"items":   "param",
+		"n":       "result",
+		"err":     "result",
+		"count":   "local",
+		"i":       "range",
+		"item":    "range",
+		"total":   "local",
+		"v":       "local",
+	}
+
+	declared := make(map[string]string)
+	for _, edge := range graph.Edges {
+		if edge.Relation != Declares || edge.To.Type != Var {
+			continue
+		}
+		declared[edge.To.Name] = edge.To.Attr("kind")
+
+		if edge.To.Attr("kind") != "global" && edge.From.Name != "Server.Handle" {
+			t.Errorf("Expected %s to be declared by Handle, got %s", edge.To, edge.From)
+		}
+		if edge.To.Attr("kind") != "global" && edge.To.Attr("scope") != "Server.Handle" {
+			t.Errorf("Expected %s to be scoped to Handle, got %q", edge.To, edge.To.Attr("scope"))
+		}
+	}
+
+	if len(declared) != len(expected) {
+		t.Errorf("Expected %d declared variables, got %v", len(expected), declared)
+	}
+	for name, kind := range expected {
+		if declared[name] != kind {
+			t.Errorf("Expected %s to be declared as %q, got %q", name, kind, declared[name])
+		}
+	}
+
+	uses := make(map[string]int)
+	for _, edge := range graph.Edges {
+		if edge.Relation == Uses {
+			uses[edge.To.Name]++
+		}
+	}
+	for _, name := range []string{"count", "items", "i", "item", "v", "req", "total"} {
+		if uses[name] == 0 {
+			t.Errorf("Expected a Uses edge to %s", name)
+		}
+	}
+}
+
+func TestExtractGraphFromAST_Package(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package server
+
+import (
+	"fmt"
+	nethttp "net/http"
+	_ "embed"
+)
+
+const DefaultPort = 8080
+
+var started bool
+
+type Server struct{}
+
+func (s *Server) Start() {
+	const retries = 3
+	fmt.Println(DefaultPort, retries)
+	nethttp.ListenAndServe(":8080", nil)
+}
+
+func New() *Server {
+	return &Server{}
+}
+`
+
+	graph, err := ExtractGraphFromAST(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	pkg := findNode(graph, Package, "server")
+	if pkg == nil {
+		t.Fatalf("Expected a package node for server")
+	}
+
+	declared := make(map[string]NodeType)
+	imports := make(map[string]string)
+	for _, edge := range graph.Edges {
+		switch {
+		case edge.Relation == Declares && edge.From == pkg:
+			declared[edge.To.Name] = edge.To.Type
+		case edge.Relation == Imports && edge.From == pkg:
+			if edge.To.Type != Package {
+				t.Errorf("Expected %s to be a package", edge.To)
+			}
+			imports[edge.To.Name] = edge.Attr("alias")
+		}
+	}
+
+	expectedDeclared := map[string]NodeType{
+		"DefaultPort":  Const,
+		"started":      Var,
+		"Server":       TypeDecl,
+		"Server.Start": Func,
+		"New":          Func,
+	}
+	if len(declared) != len(expectedDeclared) {
+		t.Errorf("Expected package to declare %v, got %v", expectedDeclared, declared)
+	}
+	for name, typ := range expectedDeclared {
+		if declared[name] != typ {
+			t.Errorf("Expected package to declare %s of type %s, got %q", name, typ, declared[name])
+		}
+	}
+
+	expectedImports := map[string]string{"fmt": "", "net/http": "nethttp", "embed": "_"}
+	if len(imports) != len(expectedImports) {
+		t.Errorf("Expected imports %v, got %v", expectedImports, imports)
+	}
+	for path, alias := range expectedImports {
+		if a, ok := imports[path]; !ok || a != alias {
+			t.Errorf("Expected import of %s with alias %q, got %q", path, alias, a)
+		}
+	}
+
+	// local constants are declared by their function, and constant usages are recorded
+	var localConst, constUses int
+	for _, edge := range graph.Edges {
+		if edge.Relation == Declares && edge.From.Name == "Server.Start" && edge.To.Type == Const {
+			localConst++
+		}
+		if edge.Relation == Uses && edge.To.Type == Const {
+			constUses++
+		}
+	}
+	if localConst != 1 {
+		t.Errorf("Expected Start to declare 1 constant, got %d", localConst)
+	}
+	if constUses != 2 {
+		t.Errorf("Expected 2 constant usages, got %d", constUses)
+	}
+}
+
+func TestExtractGraphFromAST_FuncLit(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+
+func main() {
+	count := 0
+	inc := func(n int) {
+		count += n
+	}
+	inc(1)
+	go func() {
+		worker()
+	}()
+	defer func() { cleanup(count) }()
+}
+`
+
+	graph, err := ExtractGraphFromAST(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	if got := countNodeType(graph, FuncLit); got != 3 {
+		t.Fatalf("Expected 3 function literals, got %d", got)
+	}
+
+	got := relationEdges(graph, Defines, Captures, Call, Spawns, Defers)
+	expected := []string{
+		"(main)-[:Call]->(main.func@6:9)",
+		"(main)-[:Defers]->(main.func@13:8)",
+		"(main)-[:Defines]->(main.func@10:5)",
+		"(main)-[:Defines]->(main.func@13:8)",
+		"(main)-[:Defines]->(main.func@6:9)",
+		"(main)-[:Spawns]->(main.func@10:5)",
+		"(main.func@10:5)-[:Call]->(worker)",
+		"(main.func@13:8)-[:Call]->(cleanup)",
+		"(main.func@13:8)-[:Captures]->(count)",
+		"(main.func@6:9)-[:Captures]->(count)",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected edges %v, got %v", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("Expected edge %s, got %s", expected[i], got[i])
+		}
+	}
+
+	// parameters of a literal are scoped to it, and receive the arguments of its calls
+	n := findNode(graph, Var, "n")
+	if n == nil || n.Attr("scope") != "main.func@6:9" || n.Attr("kind") != "param" {
+		t.Errorf("Expected n to be a parameter of the literal, got %v", n)
+	}
+}
+
+func TestExtractGraphFromAST_CallExpressions(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+
+import "net/http"
+
+type List[T any] struct{ items []T }
+
+func (l List[T]) Len() int { return len(l.items) }
+
+type celsius float64
+
+func identity[T any](v T) T { return v }
+
+func open() *http.Client { return nil }
+
+func main() {
+	var cfg struct{ db struct{ conn *http.Client } }
+	handlers := map[string]func(){}
+	cfg.db.conn.Do(nil)
+	open().Get(url())
+	handlers["index"]()
+	List[int]{}.Len()
+	one := 1
+	n := identity[int](one)
+	b := []byte(http.MethodGet)
+	c := celsius(n)
+	http.DefaultClient.Do(nil)
+	_, _ = b, c
+}
+
+func url() string { return "" }
+`
+
+	graph, err := ExtractGraphFromAST(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	var callees []string
+	for _, edge := range graph.Edges {
+		if edge.Relation == Call && edge.From.Name == "main" {
+			callees = append(callees, edge.To.Name)
+		}
+	}
+	expected := []string{
+		"cfg.db.conn.Do",
+		"open().Get",
+		"open",
+		"url",
+		`handlers["index"]`,
+		"List.Len",
+		"identity",
+		"http.DefaultClient.Do",
+	}
+	if len(callees) != len(expected) {
+		t.Fatalf("Expected callees %v, got %v", expected, callees)
+	}
+	for i := range callees {
+		if callees[i] != expected[i] {
+			t.Errorf("Expected callee %s, got %s", expected[i], callees[i])
+		}
+	}
+
+	// arguments of an instantiated generic function reach its parameters, and the
+	// operand of a conversion flows through it
+	flows := make(map[string]bool)
+	for _, edge := range relationEdges(graph, PassesTo, Assigns) {
+		flows[edge] = true
+	}
+	for _, edge := range []string{"(one)-[:PassesTo]->(v)", "(n)-[:Assigns]->(c)"} {
+		if !flows[edge] {
+			t.Errorf("Expected edge %s, got %v", edge, flows)
+		}
+	}
+	if http := graph.NodeMap["http.DefaultClient.Do"]; http == nil || http.Attr("pkg") != "net/http" {
+		t.Errorf("Expected http.DefaultClient.Do to belong to net/http, got %v", http)
+	}
+
+	// callees named after their expression are reported, but not the methods resolved
+	// to their declaration
+	if len(graph.Diagnostics) != 2 {
+		t.Errorf("Expected 2 diagnostics, got %v", graph.Diagnostics)
+	}
+}
@@ -0,0 +1,439 @@
+package astro
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// cfgBuilder builds the intra-procedural control-flow graph of a single function.
+//
+// Every basic block becomes a BasicBlock node named "<function>:b<index>", or
+// "<function>@<line>:<column>:b<index>" when another function of the same name already
+// has blocks, such as a second init function. Blocks are
+// connected with Next edges for unconditional flow, TrueBranch and FalseBranch edges for
+// the outcomes of a condition (if, for, range, switch cases) and Loop edges for the back
+// edges to a loop header. The function node points to the entry block with an Entry edge,
+// and every return statement flows into a dedicated exit block.
+//
+// Each block carries the attributes "kind" (entry, if.then, for.body, ...), "pos",
+// "stmts" (number of statements) and "calls" (comma separated callees, in source order),
+// so that path queries can reason about the order of calls within a function.
+type cfgBuilder struct {
+	graph  *Graph
+	fset   *token.FileSet
+	fn     string
+	prefix string
+	callee func(fun ast.Expr) (string, error) // resolves the name of a called function
+
+	blocks  []*Node
+	info    map[*Node]*blockInfo
+	current *Node // block receiving statements, nil if the code is unreachable
+	exit    *Node
+
+	targets       *branchTargets
+	label         string // label of the statement being built
+	labels        map[string]*Node
+	gotos         []pendingGoto
+	fallthroughTo *Node
+}
+
+type blockInfo struct {
+	stmts int
+	calls []string
+}
+
+// branchTargets is the stack of statements a break or continue can refer to.
+type branchTargets struct {
+	outer       *branchTargets
+	label       string
+	breakTo     *Node
+	continueTo  *Node // nil for switch and select statements
+	continueRel Relation
+}
+
+type pendingGoto struct {
+	from  *Node
+	label string
+}
+
+// buildCFG adds the control-flow graph of decl to graph and links it to funcNode.
+// callee resolves the names of the functions called in the blocks.
+func buildCFG(graph *Graph, fset *token.FileSet, decl *ast.FuncDecl, funcNode *Node, callee func(fun ast.Expr) (string, error)) {
+	if decl.Body == nil {
+		return
+	}
+
+	b := &cfgBuilder{
+		graph:  graph,
+		fset:   fset,
+		fn:     funcNode.Name,
+		prefix: funcNode.Name,
+		callee: callee,
+		info:   make(map[*Node]*blockInfo),
+		labels: make(map[string]*Node),
+	}
+
+	if _, exists := graph.NodeMap[b.prefix+":b0"]; exists {
+		pos := fset.Position(decl.Name.Pos())
+		b.prefix = fmt.Sprintf("%s@%d:%d", funcNode.Name, pos.Line, pos.Column)
+	}
+
+	entry := b.newBlock("entry", decl.Body.Lbrace)
+	b.exit = b.newBlock("exit", decl.Body.Rbrace)
+	graph.AddEdge(funcNode, entry, Entry)
+
+	b.current = entry
+	b.stmtList(decl.Body.List)
+	b.jump(b.exit, Next)
+
+	for _, g := range b.gotos {
+		if to, ok := b.labels[g.label]; ok {
+			graph.AddEdge(g.from, to, Next)
+		}
+	}
+
+	for _, block := range b.blocks {
+		info := b.info[block]
+		block.SetAttr("stmts", strconv.Itoa(info.stmts))
+		if len(info.calls) > 0 {
+			block.SetAttr("calls", strings.Join(info.calls, ","))
+		}
+	}
+}
+
+func (b *cfgBuilder) newBlock(kind string, pos token.Pos) *Node {
+	block := NewNode(BasicBlock, fmt.Sprintf("%s:b%d", b.prefix, len(b.blocks)))
+	block.SetAttr("kind", kind)
+	block.SetAttr("func", b.fn)
+	block.SetAttr("pos", b.fset.Position(pos).String())
+
+	b.graph.AddNode(block)
+	b.blocks = append(b.blocks, block)
+	b.info[block] = &blockInfo{}
+
+	return block
+}
+
+// jump connects the current block to the given block, unless the current code is unreachable.
+func (b *cfgBuilder) jump(to *Node, r Relation) {
+	if b.current != nil && to != nil {
+		b.graph.AddEdge(b.current, to, r)
+	}
+}
+
+// add records n in the current block, opening a new block if the code is unreachable.
+func (b *cfgBuilder) add(n ast.Node) {
+	if n == nil {
+		return
+	}
+	if b.current == nil {
+		b.current = b.newBlock("unreachable", n.Pos())
+	}
+
+	info := b.info[b.current]
+	if _, ok := n.(ast.Stmt); ok {
+		info.stmts++
+	}
+
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.FuncLit:
+			// calls inside function literals do not run in this block
+			return false
+		case *ast.CallExpr:
+			if name, err := b.callee(x.Fun); err == nil {
+				info.calls = append(info.calls, name)
+			}
+		}
+		return true
+	})
+}
+
+// takeLabel returns the label of the statement being built and clears it.
+func (b *cfgBuilder) takeLabel() string {
+	label := b.label
+	b.label = ""
+	return label
+}
+
+func (b *cfgBuilder) push(label string, breakTo, continueTo *Node, continueRel Relation) {
+	b.targets = &branchTargets{
+		outer:       b.targets,
+		label:       label,
+		breakTo:     breakTo,
+		continueTo:  continueTo,
+		continueRel: continueRel,
+	}
+}
+
+func (b *cfgBuilder) pop() {
+	b.targets = b.targets.outer
+}
+
+// findTarget looks up the statement referred to by a break (loop == false) or continue.
+func (b *cfgBuilder) findTarget(label *ast.Ident, loop bool) *branchTargets {
+	for t := b.targets; t != nil; t = t.outer {
+		if label != nil {
+			if t.label == label.Name {
+				return t
+			}
+			continue
+		}
+		if !loop || t.continueTo != nil {
+			return t
+		}
+	}
+	return nil
+}
+
+func (b *cfgBuilder) stmtList(list []ast.Stmt) {
+	for _, s := range list {
+		b.stmt(s)
+	}
+}
+
+func (b *cfgBuilder) stmt(s ast.Stmt) {
+	switch s := s.(type) {
+	case *ast.BlockStmt:
+		b.stmtList(s.List)
+
+	case *ast.LabeledStmt:
+		block := b.newBlock("label", s.Pos())
+		b.jump(block, Next)
+		b.current = block
+		b.labels[s.Label.Name] = block
+
+		b.label = s.Label.Name
+		b.stmt(s.Stmt)
+		b.label = ""
+
+	case *ast.IfStmt:
+		b.ifStmt(s)
+
+	case *ast.ForStmt:
+		b.forStmt(s)
+
+	case *ast.RangeStmt:
+		label := b.takeLabel()
+		b.add(s.X)
+
+		head := b.newBlock("range.loop", s.Pos())
+		b.jump(head, Next)
+		body := b.newBlock("range.body", s.Body.Pos())
+		done := b.newBlock("range.done", s.End())
+		b.graph.AddEdge(head, body, TrueBranch)
+		b.graph.AddEdge(head, done, FalseBranch)
+
+		b.push(label, done, head, Loop)
+		b.current = body
+		b.stmtList(s.Body.List)
+		b.jump(head, Loop)
+		b.pop()
+
+		b.current = done
+
+	case *ast.SwitchStmt:
+		label := b.takeLabel()
+		if s.Init != nil {
+			b.stmt(s.Init)
+		}
+		b.add(s.Tag)
+		b.switchBody(label, s.Body, s.End())
+
+	case *ast.TypeSwitchStmt:
+		label := b.takeLabel()
+		if s.Init != nil {
+			b.stmt(s.Init)
+		}
+		b.add(s.Assign)
+		b.switchBody(label, s.Body, s.End())
+
+	case *ast.SelectStmt:
+		b.selectStmt(s)
+
+	case *ast.ReturnStmt:
+		b.add(s)
+		b.jump(b.exit, Next)
+		b.current = nil
+
+	case *ast.BranchStmt:
+		b.branchStmt(s)
+
+	default:
+		b.add(s)
+	}
+}
+
+func (b *cfgBuilder) ifStmt(s *ast.IfStmt) {
+	b.takeLabel()
+	if s.Init != nil {
+		b.stmt(s.Init)
+	}
+	b.add(s.Cond)
+	cond := b.current
+
+	then := b.newBlock("if.then", s.Body.Pos())
+	done := b.newBlock("if.done", s.End())
+	els := done
+	if s.Else != nil {
+		els = b.newBlock("if.else", s.Else.Pos())
+	}
+	b.graph.AddEdge(cond, then, TrueBranch)
+	b.graph.AddEdge(cond, els, FalseBranch)
+
+	b.current = then
+	b.stmtList(s.Body.List)
+	b.jump(done, Next)
+
+	if s.Else != nil {
+		b.current = els
+		b.stmt(s.Else)
+		b.jump(done, Next)
+	}
+
+	b.current = done
+}
+
+func (b *cfgBuilder) forStmt(s *ast.ForStmt) {
+	label := b.takeLabel()
+	if s.Init != nil {
+		b.stmt(s.Init)
+	}
+
+	head := b.newBlock("for.cond", s.Pos())
+	b.jump(head, Next)
+	body := b.newBlock("for.body", s.Body.Pos())
+	done := b.newBlock("for.done", s.End())
+
+	// continue statements go to the post statement if there is one, otherwise straight
+	// back to the loop header.
+	cont, contRel := head, Loop
+	var post *Node
+	if s.Post != nil {
+		post = b.newBlock("for.post", s.Post.Pos())
+		cont, contRel = post, Next
+	}
+
+	b.current = head
+	if s.Cond != nil {
+		b.add(s.Cond)
+		b.graph.AddEdge(head, body, TrueBranch)
+		b.graph.AddEdge(head, done, FalseBranch)
+	} else {
+		b.graph.AddEdge(head, body, Next)
+	}
+
+	b.push(label, done, cont, contRel)
+	b.current = body
+	b.stmtList(s.Body.List)
+	b.jump(cont, contRel)
+	b.pop()
+
+	if post != nil {
+		b.current = post
+		b.add(s.Post)
+		b.jump(head, Loop)
+	}
+
+	b.current = done
+}
+
+// switchBody builds the case clauses of an expression or type switch. The current block
+// evaluates the tag and branches to every case with a TrueBranch edge, while the default
+// clause (or the end of the switch, without one) is reached with a FalseBranch edge.
+func (b *cfgBuilder) switchBody(label string, body *ast.BlockStmt, end token.Pos) {
+	if b.current == nil {
+		b.current = b.newBlock("unreachable", body.Pos())
+	}
+	head := b.current
+	done := b.newBlock("switch.done", end)
+
+	clauses := make([]*Node, len(body.List))
+	hasDefault := false
+	for i, s := range body.List {
+		cc := s.(*ast.CaseClause)
+		if cc.List == nil {
+			clauses[i] = b.newBlock("switch.default", cc.Pos())
+			b.graph.AddEdge(head, clauses[i], FalseBranch)
+			hasDefault = true
+			continue
+		}
+
+		for _, e := range cc.List {
+			b.add(e)
+		}
+		clauses[i] = b.newBlock("switch.case", cc.Pos())
+		b.graph.AddEdge(head, clauses[i], TrueBranch)
+	}
+	if !hasDefault {
+		b.graph.AddEdge(head, done, FalseBranch)
+	}
+
+	// a fallthrough after this switch, in a clause of an enclosing one, still targets
+	// the next clause of the enclosing switch
+	enclosing := b.fallthroughTo
+	b.push(label, done, nil, Next)
+	for i, s := range body.List {
+		b.fallthroughTo = nil
+		if i+1 < len(clauses) {
+			b.fallthroughTo = clauses[i+1]
+		}
+
+		b.current = clauses[i]
+		b.stmtList(s.(*ast.CaseClause).Body)
+		b.jump(done, Next)
+	}
+	b.fallthroughTo = enclosing
+	b.pop()
+
+	b.current = done
+}
+
+func (b *cfgBuilder) selectStmt(s *ast.SelectStmt) {
+	label := b.takeLabel()
+	if b.current == nil {
+		b.current = b.newBlock("unreachable", s.Pos())
+	}
+	head := b.current
+	done := b.newBlock("select.done", s.End())
+
+	b.push(label, done, nil, Next)
+	for _, c := range s.Body.List {
+		cc := c.(*ast.CommClause)
+		clause := b.newBlock("select.case", cc.Pos())
+		b.graph.AddEdge(head, clause, Next)
+
+		b.current = clause
+		b.add(cc.Comm)
+		b.stmtList(cc.Body)
+		b.jump(done, Next)
+	}
+	b.pop()
+
+	b.current = done
+}
+
+func (b *cfgBuilder) branchStmt(s *ast.BranchStmt) {
+	b.add(s)
+
+	switch s.Tok {
+	case token.BREAK:
+		if t := b.findTarget(s.Label, false); t != nil {
+			b.jump(t.breakTo, Next)
+		}
+	case token.CONTINUE:
+		if t := b.findTarget(s.Label, true); t != nil {
+			b.jump(t.continueTo, t.continueRel)
+		}
+	case token.GOTO:
+		// labels may be declared after the goto, so resolve them once the body is built
+		b.gotos = append(b.gotos, pendingGoto{from: b.current, label: s.Label.Name})
+	case token.FALLTHROUGH:
+		b.jump(b.fallthroughTo, Next)
+	}
+
+	b.current = nil
+}
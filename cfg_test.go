@@ -0,0 +1,261 @@
+package astro
+
+import (
+	"strings"
+	"testing"
+)
+
+func countRelations(g *Graph) map[Relation]int {
+	counts := make(map[Relation]int)
+	for _, edge := range g.Edges {
+		counts[edge.Relation]++
+	}
+	return counts
+}
+
+func countNodeType(g *Graph, t NodeType) int {
+	count := 0
+	for _, node := range g.Nodes {
+		if node.Type == t {
+			count++
+		}
+	}
+	return count
+}
+
+// findNode returns the first node of the given type and name, including nodes
+// which are not registered in the node map.
+func findNode(g *Graph, t NodeType, name string) *Node {
+	for _, node := range g.Nodes {
+		if node.Type == t && node.Name == name {
+			return node
+		}
+	}
+	return nil
+}
+
+func TestExtractGraphWithCFG(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		src            string
+		expectedBlocks int
+		expectedEdges  map[Relation]int
+	}{
+		{
+			name: "straight line",
+			src: `
+package main
+func main() {
+	a()
+	b()
+}`,
+			expectedBlocks: 2, // entry, exit
+			expectedEdges:  map[Relation]int{Call: 2, Entry: 1, Next: 1},
+		},
+		{
+			name: "if else",
+			src: `
+package main
+func f(x int) {
+	if x > 0 {
+		a()
+	} else {
+		b()
+	}
+	c()
+}`,
+			expectedBlocks: 5, // entry, exit, if.then, if.else, if.done
+			expectedEdges:  map[Relation]int{Call: 3, Entry: 1, TrueBranch: 1, FalseBranch: 1, Next: 3},
+		},
+		{
+			name: "for loop with continue",
+			src: `
+package main
+func f(n int) {
+	for i := 0; i < n; i++ {
+		if i == 2 {
+			continue
+		}
+		work()
+	}
+}`,
+			// entry, exit, for.cond, for.body, for.done, for.post, if.then, if.done
+			expectedBlocks: 8,
+			expectedEdges:  map[Relation]int{Call: 1, Entry: 1, TrueBranch: 2, FalseBranch: 2, Next: 4, Loop: 1},
+		},
+		{
+			name: "range with break",
+			src: `
+package main
+func f(xs []int) {
+	for _, x := range xs {
+		if x < 0 {
+			break
+		}
+	}
+}`,
+			// entry, exit, range.loop, range.body, range.done, if.then, if.done
+			expectedBlocks: 7,
+			expectedEdges:  map[Relation]int{Entry: 1, TrueBranch: 2, FalseBranch: 2, Next: 3, Loop: 1},
+		},
+		{
+			name: "switch without default",
+			src: `
+package main
+func f(x int) int {
+	switch x {
+	case 1:
+		return 10
+	case 2:
+		fallthrough
+	case 3:
+		return 30
+	}
+	return 0
+}`,
+			// entry, exit, switch.done, 3 cases
+			expectedBlocks: 6,
+			expectedEdges:  map[Relation]int{Entry: 1, TrueBranch: 3, FalseBranch: 1, Next: 4},
+		},
+		{
+			name: "fallthrough after a nested switch",
+			src: `
+package main
+func f(x, y int) int {
+	switch x {
+	case 1:
+		switch y {
+		case 2:
+			return 20
+		}
+		fallthrough
+	case 3:
+		return 30
+	}
+	return 0
+}`,
+			// entry, exit, switch.done and 2 cases, nested switch.done and case
+			expectedBlocks: 7,
+			expectedEdges:  map[Relation]int{Entry: 1, TrueBranch: 3, FalseBranch: 2, Next: 4},
+		},
+		{
+			name: "unreachable code after return",
+			src: `
+package main
+func f() {
+	return
+	a()
+}`,
+			expectedBlocks: 3, // entry, exit, unreachable
+			expectedEdges:  map[Relation]int{Call: 1, Entry: 1, Next: 2},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			graph, err := ExtractGraphWithCFG(tc.src)
+			if err != nil {
+				t.Fatalf("Error extracting graph: %s", err)
+			}
+
+			if got := countNodeType(graph, BasicBlock); got != tc.expectedBlocks {
+				t.Errorf("Expected %d basic blocks, got %d", tc.expectedBlocks, got)
+			}
+
+			counts := countRelations(graph)
+			for _, r := range []Relation{Call, Entry, Next, TrueBranch, FalseBranch, Loop} {
+				if counts[r] != tc.expectedEdges[r] {
+					t.Errorf("Expected %d %s edges, got %d\n%v", tc.expectedEdges[r], r, counts[r], graph.Edges)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractGraphWithCFG_CallOrder(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+func main() {
+	open()
+	if ready() {
+		write()
+	}
+	close()
+}`
+
+	graph, err := ExtractGraphWithCFG(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	entry := graph.NodeMap["main:b0"]
+	if entry == nil {
+		t.Fatalf("entry block not found")
+	}
+	if got := entry.Attr("calls"); got != "open,ready" {
+		t.Errorf("Expected entry block calls %q, got %q", "open,ready", got)
+	}
+
+	// close can only be reached after write was possibly called
+	path, found := MultiPathPruning(graph, findNode(graph, Func, "main"), func(n *Node) bool {
+		return n.Type == BasicBlock && strings.Contains(n.Attr("calls"), "close")
+	})
+	if !found {
+		t.Fatalf("Expected a path from main to the block calling close")
+	}
+	if path[1] != entry {
+		t.Errorf("Expected the path to start at the entry block, got %v", path)
+	}
+}
+
+func TestExtractGraphFromAST_NoCFG(t *testing.T) {
+	t.Parallel()
+
+	graph, err := ExtractGraphFromAST("package main\nfunc main() { if true { a() } }")
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+	if got := countNodeType(graph, BasicBlock); got != 0 {
+		t.Errorf("Expected no basic blocks without CFG extraction, got %d", got)
+	}
+}
+
+func TestExtractGraphWithCFG_SameName(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+type A struct{}
+type B struct{}
+func (A) String() string { return "a" }
+func (B) String() string { return "b" }
+func init() { setup() }
+func init() { if ready() { start() } }`
+
+	graph, err := ExtractGraphWithCFG(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	listed := make(map[*Node]bool)
+	for _, node := range graph.Nodes {
+		listed[node] = true
+	}
+	for _, edge := range graph.Edges {
+		if !listed[edge.From] || !listed[edge.To] {
+			t.Errorf("Expected the nodes of %s in the graph", edge)
+		}
+	}
+
+	// two blocks per function, and two more for the if statement
+	if got := countNodeType(graph, BasicBlock); got != 10 {
+		t.Errorf("Expected 10 basic blocks, got %d", got)
+	}
+	if graph.NodeMap["init:b0"] == nil || graph.NodeMap["init@8:6:b0"] == nil {
+		t.Errorf("Expected the blocks of both init functions")
+	}
+}
@@ -0,0 +1,314 @@
+package astro
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// Concurrency edges relate functions to the goroutines they start and to the channels
+// and mutexes they operate on:
+//
+//	go worker(ch)      current function -[:Spawns]-> worker
+//	ch <- v            current function -[:Sends]-> ch, and v -[:Assigns]-> ch
+//	v := <-ch          current function -[:Receives]-> ch
+//	for v := range ch  current function -[:Receives]-> ch
+//	mu.Lock()          current function -[:Locks]-> mu
+//	mu.Unlock()        current function -[:Unlocks]-> mu
+//
+// Every concurrency edge carries a "pos" attribute with the position it was found at.
+// Channel operations of a select case are marked with a "select" attribute, and
+// deferred unlocks with a "deferred" attribute.
+
+// spawn marks the call of a go statement, so that it is extracted as a Spawns edge
+// rather than a Call edge.
+func (e *extractor) spawn(x *ast.GoStmt) {
+	e.spawned[x.Call] = true
+}
+
+// send adds the Sends edge of a send statement, and the flow of the sent value into the channel.
+func (e *extractor) send(x *ast.SendStmt) {
+	ch := e.channelNode(x.Chan)
+	e.addConcurrency(ch, Sends, x)
+	e.flow(x.Value, ch, Assigns)
+}
+
+// receive adds the Receives edge of a receive operation.
+func (e *extractor) receive(x *ast.UnaryExpr) {
+	if x.Op != token.ARROW {
+		return
+	}
+	e.addConcurrency(e.channelNode(x.X), Receives, x)
+}
+
+// rangeChannel adds a Receives edge for a range loop over a variable known to be a channel.
+func (e *extractor) rangeChannel(x *ast.RangeStmt) {
+	ident, ok := x.X.(*ast.Ident)
+	if !ok || ident.Obj == nil {
+		return
+	}
+	if node, exists := e.objects[ident.Obj]; exists && node.Type == Channel {
+		e.addConcurrency(node, Receives, x)
+	}
+}
+
+// selectCase records the channel operation of a select case, found as a send statement,
+// or as a receive operation possibly assigned to variables.
+func (e *extractor) selectCase(x *ast.CommClause) {
+	var op ast.Node
+	switch comm := x.Comm.(type) {
+	case *ast.SendStmt:
+		op = comm
+	case *ast.ExprStmt:
+		op = comm.X
+	case *ast.AssignStmt:
+		if len(comm.Rhs) == 1 {
+			op = comm.Rhs[0]
+		}
+	}
+
+	if op != nil {
+		e.selected[op] = true
+	}
+}
+
+// lockCall adds a Locks or Unlocks edge if x calls a method of a mutex.
+//
+// Without type information, any call of Lock, RLock, Unlock or RUnlock without arguments
+// is taken as a mutex operation, unless the receiver is a variable declared with a type of
+// another package than sync.Mutex or sync.RWMutex. Types of the extracted package are
+// accepted, since they may embed a mutex. See mutexNode for how mutexes are identified.
+func (e *extractor) lockCall(x *ast.CallExpr) {
+	sel, ok := x.Fun.(*ast.SelectorExpr)
+	if !ok || len(x.Args) != 0 {
+		return
+	}
+
+	var r Relation
+	switch sel.Sel.Name {
+	case "Lock", "RLock":
+		r = Locks
+	case "Unlock", "RUnlock":
+		r = Unlocks
+	default:
+		return
+	}
+
+	if ident, ok := sel.X.(*ast.Ident); ok {
+		if _, isImport := e.imports[ident.Name]; isImport && ident.Obj == nil {
+			return
+		}
+		if typ := declaredType(ident); typ != nil && isForeignType(typ) && !isMutexType(typ) {
+			return
+		}
+	}
+
+	mu := e.mutexNode(sel)
+	edge := e.addConcurrency(mu, r, x)
+	edge.SetAttr("op", sel.Sel.Name)
+	if e.deferred[x] {
+		edge.SetAttr("deferred", "true")
+	}
+}
+
+// mutexNode returns the Mutex node of the mutex whose method is selected by sel.
+//
+// With type information, mutexes are identified by the variable or struct field holding
+// them, including a mutex embedded in a struct as in s.Lock(). A variable is named after
+// itself (e.g. "mu"), and a field after its struct type (e.g. "Server.mu"), so that the
+// methods of a type share the mutexes of its fields whatever their receiver is named,
+// while local variables sharing a name are kept apart. Any other mutex, such as the
+// result of a call, is named after the receiver expression (e.g. "s.mu" or "lock()"),
+// and shared by the uses of the same expression.
+func (e *extractor) mutexNode(sel *ast.SelectorExpr) *Node {
+	v, name := e.mutexVar(sel)
+	if v == nil {
+		return e.namedNode(e.mutexes, Mutex, sel.X)
+	}
+	if node, exists := e.mutexVars[v]; exists {
+		return node
+	}
+
+	node := NewNode(Mutex, name)
+	node.SetAttr("pos", e.fset.Position(sel.X.Pos()).String())
+	e.graph.Nodes = append(e.graph.Nodes, node)
+	e.mutexVars[v] = node
+
+	return node
+}
+
+// mutexVar returns the variable or field holding the mutex whose method is selected by
+// sel, and the name of its node, or nil if it is not known.
+func (e *extractor) mutexVar(sel *ast.SelectorExpr) (*types.Var, string) {
+	// methods promoted from an embedded mutex
+	if selection, ok := e.info.Selections[sel]; ok && len(selection.Index()) > 1 {
+		path := selection.Index()
+		owner, field := embeddedField(selection.Recv(), path[:len(path)-1])
+		if owner == nil || field == nil {
+			return nil, ""
+		}
+		return field.Origin(), e.objectName(owner.Origin().Obj()) + "." + field.Name()
+	}
+
+	x := sel.X
+	for {
+		paren, ok := x.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		x = paren.X
+	}
+
+	switch x := x.(type) {
+	case *ast.Ident:
+		v, ok := e.info.Uses[x].(*types.Var)
+		if !ok {
+			return nil, ""
+		}
+		if isGlobal(v) {
+			return v, e.objectName(v)
+		}
+		return v, e.qualify(v.Name())
+	case *ast.SelectorExpr:
+		selection, ok := e.info.Selections[x]
+		if !ok {
+			// variables of imported packages, as in pkg.mu
+			if v, ok := e.info.Uses[x.Sel].(*types.Var); ok && isGlobal(v) {
+				return v, e.objectName(v)
+			}
+			return nil, ""
+		}
+		if selection.Kind() != types.FieldVal {
+			return nil, ""
+		}
+		owner, field := embeddedField(selection.Recv(), selection.Index())
+		if owner == nil || field == nil {
+			return nil, ""
+		}
+		return field.Origin(), e.objectName(owner.Origin().Obj()) + "." + field.Name()
+	}
+	return nil, ""
+}
+
+// addConcurrency adds an edge with relation r from the current function to target.
+func (e *extractor) addConcurrency(target *Node, r Relation, at ast.Node) *Edge {
+	edge := e.graph.AddEdge(e.currentFunc, target, r)
+	edge.SetAttr("pos", e.fset.Position(at.Pos()).String())
+	if e.selected[at] {
+		edge.SetAttr("select", "true")
+	}
+	return edge
+}
+
+// channelNode returns the Channel node of the channel expression. A channel held by a
+// variable is the node of the variable, turned into a Channel node. Any other channel,
+// such as a struct field or the result of a call, is named after its expression.
+func (e *extractor) channelNode(expr ast.Expr) *Node {
+	if ident, ok := expr.(*ast.Ident); ok && ident.Obj != nil && ident.Obj.Kind == ast.Var {
+		node := e.varNode(ident)
+		node.SetType(Channel)
+		return node
+	}
+	return e.namedNode(e.channels, Channel, expr)
+}
+
+// namedNode returns the node of type t named after expr, creating it if needed. Nodes
+// named after an expression are qualified like functions, and kept out of the node map.
+func (e *extractor) namedNode(nodes map[string]*Node, t NodeType, expr ast.Expr) *Node {
+	name := e.qualify(types.ExprString(expr))
+	if node, exists := nodes[name]; exists {
+		return node
+	}
+
+	node := NewNode(t, name)
+	node.SetAttr("pos", e.fset.Position(expr.Pos()).String())
+	e.graph.Nodes = append(e.graph.Nodes, node)
+	nodes[name] = node
+
+	return node
+}
+
+// markChannel turns the node of a variable into a Channel node if its declared type
+// or the value it is initialized with is a channel.
+func markChannel(node *Node, typ, value ast.Expr) {
+	if node == nil {
+		return
+	}
+	if _, ok := typ.(*ast.ChanType); ok || isMakeChan(value) {
+		node.SetType(Channel)
+	}
+}
+
+// isMakeChan reports whether expr is a make(chan T) call.
+func isMakeChan(expr ast.Expr) bool {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok || len(call.Args) == 0 {
+		return false
+	}
+	if fun, ok := call.Fun.(*ast.Ident); !ok || fun.Name != "make" {
+		return false
+	}
+	_, ok = call.Args[0].(*ast.ChanType)
+	return ok
+}
+
+// declaredType returns the type a variable was declared with, when written in its declaration.
+func declaredType(ident *ast.Ident) ast.Expr {
+	if ident.Obj == nil {
+		return nil
+	}
+
+	switch decl := ident.Obj.Decl.(type) {
+	case *ast.ValueSpec:
+		if decl.Type != nil {
+			return decl.Type
+		}
+		for i, name := range decl.Names {
+			if name.Name == ident.Name && i < len(decl.Values) {
+				return literalType(decl.Values[i])
+			}
+		}
+	case *ast.Field:
+		return decl.Type
+	case *ast.AssignStmt:
+		for i, l := range decl.Lhs {
+			if l, ok := l.(*ast.Ident); ok && l.Name == ident.Name && len(decl.Lhs) == len(decl.Rhs) {
+				return literalType(decl.Rhs[i])
+			}
+		}
+	}
+
+	return nil
+}
+
+// literalType returns the type of a composite literal value, or of the address of one.
+func literalType(value ast.Expr) ast.Expr {
+	if unary, ok := value.(*ast.UnaryExpr); ok && unary.Op == token.AND {
+		value = unary.X
+	}
+	if lit, ok := value.(*ast.CompositeLit); ok {
+		return lit.Type
+	}
+	return nil
+}
+
+// isForeignType reports whether typ is a type of an imported package, or a pointer to one.
+func isForeignType(typ ast.Expr) bool {
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	_, ok := typ.(*ast.SelectorExpr)
+	return ok
+}
+
+// isMutexType reports whether typ is sync.Mutex or sync.RWMutex, or a pointer to one.
+func isMutexType(typ ast.Expr) bool {
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	switch types.ExprString(typ) {
+	case "sync.Mutex", "sync.RWMutex":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package astro
+
+import (
+	"testing"
+)
+
+func TestExtractGraphFromAST_Concurrency(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+
+import (
+	"sync"
+
+	"github.com/gofrs/flock"
+)
+
+var mu sync.Mutex
+
+type server struct {
+	mu      sync.RWMutex
+	results chan int
+}
+
+func main() {
+	jobs := make(chan int)
+	done := make(chan bool)
+	go worker(jobs, done)
+	jobs <- 1
+	close(jobs)
+	<-done
+}
+
+func worker(jobs <-chan int, done chan<- bool) {
+	for job := range jobs {
+		mu.Lock()
+		process(job)
+		mu.Unlock()
+	}
+	done <- true
+}
+
+func (s *server) wait(quit chan struct{}) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	select {
+	case r := <-s.results:
+		process(r)
+	case <-quit:
+	}
+}
+
+func unlock(l *flock.Flock) {
+	l.Unlock()
+}
+`
+
+	graph, err := ExtractGraphFromAST(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	got := relationEdges(graph, Spawns, Sends, Receives, Locks, Unlocks)
+	expected := []string{
+		"(main)-[:Receives]->(done)",
+		"(main)-[:Sends]->(jobs)",
+		"(main)-[:Spawns]->(worker)",
+		"(server.wait)-[:Locks]->(server.mu)",
+		"(server.wait)-[:Receives]->(quit)",
+		"(server.wait)-[:Receives]->(s.results)",
+		"(server.wait)-[:Unlocks]->(server.mu)",
+		"(worker)-[:Locks]->(mu)",
+		"(worker)-[:Receives]->(jobs)",
+		"(worker)-[:Sends]->(done)",
+		"(worker)-[:Unlocks]->(mu)",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected edges %v, got %v", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("Expected edge %s, got %s", expected[i], got[i])
+		}
+	}
+
+	// the channel parameters of worker are distinct from the channels of main
+	if got := countNodeType(graph, Channel); got != 6 {
+		t.Errorf("Expected 6 channel nodes, got %d", got)
+	}
+	for _, name := range []string{"jobs", "done", "quit", "s.results"} {
+		if findNode(graph, Channel, name) == nil {
+			t.Errorf("Expected a channel node %s", name)
+		}
+	}
+	if got := countNodeType(graph, Mutex); got != 2 {
+		t.Errorf("Expected 2 mutex nodes, got %d", got)
+	}
+
+	for _, edge := range graph.Edges {
+		switch {
+		case edge.Relation == Unlocks && edge.To.Name == "server.mu":
+			if edge.Attr("deferred") != "true" || edge.Attr("op") != "RUnlock" {
+				t.Errorf("Expected a deferred RUnlock, got %v", edge.Attrs)
+			}
+		case edge.Relation == Receives && edge.From.Name == "server.wait":
+			if edge.Attr("select") != "true" {
+				t.Errorf("Expected %s to be a select case", edge)
+			}
+		case edge.Relation == Receives && edge.From.Name == "main":
+			if edge.Attr("select") != "" {
+				t.Errorf("Expected %s not to be a select case", edge)
+			}
+		}
+	}
+}
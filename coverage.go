@@ -0,0 +1,150 @@
+package astro
+
+import (
+	"fmt"
+	"go/ast"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// testPrefixes lists the prefixes of the functions of test files run by go test, with
+// the kind of TestFunc node they are extracted as.
+var testPrefixes = []struct {
+	prefix, kind string
+}{
+	{"Test", "test"},
+	{"Benchmark", "benchmark"},
+	{"Fuzz", "fuzz"},
+	{"Example", "example"},
+}
+
+// testKind returns the kind of test function declared by decl, or an empty string if
+// decl is not a test function. Like go test, test functions are the top-level functions
+// of test files named after one of testPrefixes followed by a name not starting with a
+// lowercase letter; TestMain is of the "main" kind.
+func (e *extractor) testKind(decl *ast.FuncDecl) string {
+	if decl.Recv != nil || !strings.HasSuffix(e.fset.Position(decl.Pos()).Filename, "_test.go") {
+		return ""
+	}
+
+	name := decl.Name.Name
+	if name == "TestMain" {
+		return "main"
+	}
+	for _, p := range testPrefixes {
+		if !strings.HasPrefix(name, p.prefix) {
+			continue
+		}
+		r, _ := utf8.DecodeRuneInString(name[len(p.prefix):])
+		if len(name) == len(p.prefix) || !unicode.IsLower(r) {
+			return p.kind
+		}
+	}
+	return ""
+}
+
+// isFunction reports whether n is a function declared or called, including the test
+// functions but not the function literals.
+func isFunction(n *Node) bool {
+	return n.Type == Func || n.Type == TestFunc
+}
+
+// FuncCoverage is a production function with the tests reaching it.
+type FuncCoverage struct {
+	Func  *Node
+	Tests []*Node // test functions reaching the function, sorted by name
+}
+
+// Covered reports whether a test reaches the function.
+func (c *FuncCoverage) Covered() bool {
+	return len(c.Tests) > 0
+}
+
+// CoverageReport maps the production functions of a graph to the tests reaching them.
+type CoverageReport struct {
+	Funcs     []*FuncCoverage // every production function, sorted by name
+	Uncovered []*Node         // production functions reached by no test, sorted by name
+}
+
+// Coverage returns the static coverage of the production functions of graph by its
+// tests: the functions declared in the extracted tree outside test files, each with the
+// TestFunc nodes from which it can be reached. The graph must be extracted with its test
+// files; see WithTests.
+//
+// A test reaches the functions it calls, directly or not, following the Call, Defers,
+// Spawns, Defines and Instantiates edges like AnalyzeImpact does the other way round.
+// Every kind of test function counts, including benchmarks, examples and TestMain. Calls
+// through a function value or an interface are not followed, so a function reported as
+// uncovered may still run in a test.
+func Coverage(graph *Graph) *CoverageReport {
+	callees := make(map[*Node][]*Node)
+	for _, edge := range graph.Edges {
+		if impactRelations[edge.Relation] {
+			callees[edge.From] = append(callees[edge.From], edge.To)
+		}
+	}
+
+	var tests []*Node
+	funcs := make(map[*Node]*FuncCoverage)
+	report := &CoverageReport{}
+	for _, node := range graph.Nodes {
+		switch {
+		case node.Type == TestFunc:
+			tests = append(tests, node)
+		case node.Type == Func && node.Attr("pos") != "" && !inTestFile(node):
+			if funcs[node] == nil {
+				funcs[node] = &FuncCoverage{Func: node}
+				report.Funcs = append(report.Funcs, funcs[node])
+			}
+		}
+	}
+	sort.Slice(tests, func(i, j int) bool {
+		return tests[i].Name < tests[j].Name
+	})
+
+	for _, test := range tests {
+		visited := map[*Node]bool{test: true}
+		queue := []*Node{test}
+		for i := 0; i < len(queue); i++ {
+			for _, callee := range callees[queue[i]] {
+				if visited[callee] {
+					continue
+				}
+				visited[callee] = true
+				queue = append(queue, callee)
+				if c, ok := funcs[callee]; ok {
+					c.Tests = append(c.Tests, test)
+				}
+			}
+		}
+	}
+
+	sort.Slice(report.Funcs, func(i, j int) bool {
+		return report.Funcs[i].Func.Name < report.Funcs[j].Func.Name
+	})
+	for _, c := range report.Funcs {
+		if !c.Covered() {
+			report.Uncovered = append(report.Uncovered, c.Func)
+		}
+	}
+
+	return report
+}
+
+// String formats the report with a line per production function, e.g.
+//
+//	store.Open: store.TestOpen, store.TestServe
+//	store.validate: not reached by any test
+func (r *CoverageReport) String() string {
+	var b strings.Builder
+	for _, c := range r.Funcs {
+		if c.Covered() {
+			fmt.Fprintf(&b, "%s: %s\n", c.Func.Name, nodeNames(c.Tests))
+		} else {
+			fmt.Fprintf(&b, "%s: not reached by any test\n", c.Func.Name)
+		}
+	}
+	return b.String()
+}
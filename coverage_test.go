@@ -0,0 +1,181 @@
+package astro
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	t.Parallel()
+
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.21\n",
+		"store/store.go": `package store
+
+func Open(name string) error {
+	return validate(name)
+}
+
+func Close() {
+	defer flush()
+}
+
+func validate(name string) error {
+	return nil
+}
+
+func flush() {}
+
+func Unused() {}
+
+func MustOpen(name string) {
+	if err := Open(name); err != nil {
+		panic(err)
+	}
+}
+`,
+		"store/store_test.go": `package store
+
+import "testing"
+
+func TestOpen(t *testing.T) {
+	setup()
+	Open("test")
+}
+
+func BenchmarkClose(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Close()
+	}
+}
+
+func TestMustOpen(t *testing.T) {
+	MustOpen("test")
+}
+
+func Testing() {}
+
+func setup() {
+	flush()
+}
+`,
+		"store/example_test.go": `package store_test
+
+import "example.com/app/store"
+
+func ExampleOpen() {
+	store.Open("example")
+}
+`,
+	})
+
+	graph, err := NewBuilder(WithTests(true)).ExtractDir(root)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	kinds := map[string]string{
+		"example.com/app/store.TestOpen":         "test",
+		"example.com/app/store.TestMustOpen":     "test",
+		"example.com/app/store.BenchmarkClose":   "benchmark",
+		"example.com/app/store_test.ExampleOpen": "example",
+	}
+	for name, kind := range kinds {
+		node := findNode(graph, TestFunc, name)
+		if node == nil {
+			t.Errorf("Expected test function %s", name)
+			continue
+		}
+		if node.Attr("kind") != kind {
+			t.Errorf("Expected %s to be of kind %s, got %q", name, kind, node.Attr("kind"))
+		}
+	}
+	if got := countNodeType(graph, TestFunc); got != len(kinds) {
+		t.Errorf("Expected %d test functions, got %d", len(kinds), got)
+	}
+	if findNode(graph, Func, "example.com/app/store.Testing") == nil {
+		t.Errorf("Expected Testing not to be a test function")
+	}
+
+	report := Coverage(graph)
+	expected := `example.com/app/store.Close: example.com/app/store.BenchmarkClose
+example.com/app/store.MustOpen: example.com/app/store.TestMustOpen
+example.com/app/store.Open: example.com/app/store.TestMustOpen, example.com/app/store.TestOpen, example.com/app/store_test.ExampleOpen
+example.com/app/store.Unused: not reached by any test
+example.com/app/store.flush: example.com/app/store.BenchmarkClose, example.com/app/store.TestOpen
+example.com/app/store.validate: example.com/app/store.TestMustOpen, example.com/app/store.TestOpen, example.com/app/store_test.ExampleOpen
+`
+	if got := report.String(); got != expected {
+		t.Errorf("Expected report:\n%s\ngot:\n%s", expected, got)
+	}
+	if got := nodeNames(report.Uncovered); got != "example.com/app/store.Unused" {
+		t.Errorf("Expected Unused to be uncovered, got %s", got)
+	}
+
+	// tests of the graph are affected by the functions they reach
+	impact := AnalyzeImpact(graph, []*Node{findNode(graph, Func, "example.com/app/store.validate")})
+	if got := impact.TestPattern(); got != "^(ExampleOpen|TestMustOpen|TestOpen)$" {
+		t.Errorf("Expected ExampleOpen, TestMustOpen and TestOpen to be affected, got %s", got)
+	}
+	if strings.Contains(report.String(), "setup") {
+		t.Errorf("Expected the helpers of test files not to be reported, got:\n%s", report)
+	}
+}
+
+func TestCoverage_Methods(t *testing.T) {
+	t.Parallel()
+
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.21\n",
+		"store/store.go": `package store
+
+type A struct{}
+
+func (a *A) Close() {
+	a.flush()
+}
+
+func (a *A) flush() {}
+
+type B struct{}
+
+func (B) Close() {
+	release()
+}
+
+func release() {}
+`,
+		"store/store_test.go": `package store
+
+import "testing"
+
+func TestClose(t *testing.T) {
+	var a A
+	a.Close()
+}
+`,
+		"store/example_test.go": `package store_test
+
+import "example.com/app/store"
+
+func ExampleB_Close() {
+	store.B{}.Close()
+}
+`,
+	})
+
+	graph, err := NewBuilder(WithTests(true)).ExtractDir(root)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	report := Coverage(graph)
+	expected := `example.com/app/store.A.Close: example.com/app/store.TestClose
+example.com/app/store.A.flush: example.com/app/store.TestClose
+example.com/app/store.B.Close: example.com/app/store_test.ExampleB_Close
+example.com/app/store.release: example.com/app/store_test.ExampleB_Close
+`
+	if got := report.String(); got != expected {
+		t.Errorf("Expected report:\n%s\ngot:\n%s", expected, got)
+	}
+}
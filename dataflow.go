@@ -0,0 +1,215 @@
+package astro
+
+import (
+	"errors"
+	"go/ast"
+	"go/token"
+)
+
+// Data-flow edges point in the direction values travel:
+//
+//	x := f()      f -[:Assigns]-> x
+//	y = x + 1     x -[:Assigns]-> y
+//	g(y)          y -[:PassesTo]-> p  (p being the matching parameter of g)
+//	return y      y -[:Return]-> current function
+//	ch <- y       y -[:Assigns]-> ch
+//
+// Following these edges traces a value from where it is produced to where it is consumed.
+// Every data-flow edge carries a "pos" attribute with the position it was found at.
+
+// assign adds Assigns edges from the values on the right-hand side to the variables
+// on the left-hand side of an assignment or a variable declaration.
+func (e *extractor) assign(lhs, rhs []ast.Expr) {
+	if len(rhs) == 0 {
+		return
+	}
+
+	for i, l := range lhs {
+		target := e.writtenVar(l)
+		if target == nil || target.Name == "_" {
+			continue
+		}
+		targetNode := e.assignedVar(target)
+		if targetNode == nil {
+			continue
+		}
+
+		// x, y = f() assigns the results of f to every variable
+		value := rhs[0]
+		if len(lhs) == len(rhs) {
+			value = rhs[i]
+		}
+		e.flow(value, targetNode, Assigns)
+
+		// calls of a variable holding a function literal are calls of the literal
+		if lit, ok := value.(*ast.FuncLit); ok && target == l && target.Obj != nil {
+			e.litVars[target.Obj] = lit
+		}
+	}
+}
+
+// passArgs adds PassesTo edges from the arguments of a call to the parameters of the callee.
+//
+// Parameters are only known for functions declared in the extracted source. For any
+// other callee, such as a library function, the arguments flow into the callee node itself.
+func (e *extractor) passArgs(x *ast.CallExpr) {
+	callee, sig, err := e.callee(x.Fun)
+	if err != nil {
+		return
+	}
+
+	var params []*ast.Ident
+	variadic := false
+	if sig != nil {
+		for _, field := range sig.Params.List {
+			params = append(params, field.Names...)
+			_, variadic = field.Type.(*ast.Ellipsis)
+		}
+	}
+
+	for i, arg := range x.Args {
+		var param *Node
+		switch {
+		case i < len(params):
+			param = e.varNode(params[i])
+		case variadic && len(params) > 0:
+			param = e.varNode(params[len(params)-1])
+		}
+		target := callee
+		if param != nil {
+			target = param
+		}
+		if target.Name == "_" {
+			continue
+		}
+		e.flow(arg, target, PassesTo)
+	}
+}
+
+// flow adds an edge with the given relation from every source of expr to target.
+func (e *extractor) flow(expr ast.Expr, target *Node, r Relation) {
+	for _, source := range e.sources(expr) {
+		e.addFlow(source, target, r, expr.Pos())
+	}
+}
+
+func (e *extractor) addFlow(from, to *Node, r Relation, pos token.Pos) {
+	edge := e.graph.AddEdge(from, to, r)
+	edge.SetAttr("pos", e.fset.Position(pos).String())
+}
+
+// sources returns the nodes whose values contribute to the value of expr: the variables
+// it reads and the functions whose results it uses.
+func (e *extractor) sources(expr ast.Expr) []*Node {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		if x.Obj != nil && x.Obj.Kind == ast.Var && x.Name != "_" {
+			return []*Node{e.varNode(x)}
+		}
+	case *ast.CallExpr:
+		callee, _, err := e.callee(x.Fun)
+		if errors.Is(err, errConversion) && len(x.Args) == 1 {
+			return e.sources(x.Args[0])
+		}
+		if err == nil {
+			return []*Node{callee}
+		}
+	case *ast.BinaryExpr:
+		return append(e.sources(x.X), e.sources(x.Y)...)
+	case *ast.UnaryExpr:
+		return e.sources(x.X)
+	case *ast.ParenExpr:
+		return e.sources(x.X)
+	case *ast.StarExpr:
+		return e.sources(x.X)
+	case *ast.SelectorExpr:
+		return e.sources(x.X)
+	case *ast.IndexExpr:
+		return e.sources(x.X)
+	case *ast.SliceExpr:
+		return e.sources(x.X)
+	case *ast.TypeAssertExpr:
+		return e.sources(x.X)
+	case *ast.KeyValueExpr:
+		return e.sources(x.Value)
+	case *ast.CompositeLit:
+		var nodes []*Node
+		for _, elt := range x.Elts {
+			nodes = append(nodes, e.sources(elt)...)
+		}
+		return nodes
+	}
+
+	return nil
+}
+
+// assignedVar returns the node of the variable written through ident, as returned by
+// writtenVar, or nil if it is not a variable of the graph: identifiers the parser did not
+// resolve are package-level variables of other files and packages, if anything.
+func (e *extractor) assignedVar(ident *ast.Ident) *Node {
+	if ident.Obj == nil {
+		return e.globalNode(ident)
+	}
+	return e.varNode(ident)
+}
+
+func exprList(idents []*ast.Ident) []ast.Expr {
+	exprs := make([]ast.Expr, len(idents))
+	for i, ident := range idents {
+		exprs[i] = ident
+	}
+	return exprs
+}
+
+// DefUse is the def-use chain of a variable: the edges defining its value and
+// the edges its value flows through.
+type DefUse struct {
+	Var  *Node
+	Defs []*Edge // Assigns and PassesTo edges into the variable
+	Uses []*Edge // Assigns, PassesTo and Return edges out of the variable
+}
+
+// DefUseChains computes the def-use chain of every variable taking part in data flow,
+// in the order the variables appear in the graph.
+func (g *Graph) DefUseChains() []*DefUse {
+	chains := make(map[*Node]*DefUse)
+	chain := func(n *Node) *DefUse {
+		if _, ok := chains[n]; !ok {
+			chains[n] = &DefUse{Var: n}
+		}
+		return chains[n]
+	}
+
+	for _, edge := range g.Edges {
+		if !isDataFlow(edge.Relation) {
+			continue
+		}
+		if isVariable(edge.To) && edge.Relation != Return {
+			du := chain(edge.To)
+			du.Defs = append(du.Defs, edge)
+		}
+		if isVariable(edge.From) {
+			du := chain(edge.From)
+			du.Uses = append(du.Uses, edge)
+		}
+	}
+
+	result := make([]*DefUse, 0, len(chains))
+	for _, node := range g.Nodes {
+		if du, ok := chains[node]; ok {
+			result = append(result, du)
+			delete(chains, node)
+		}
+	}
+
+	return result
+}
+
+func isDataFlow(r Relation) bool {
+	return r == Assigns || r == PassesTo || r == Return
+}
+
+// isVariable reports whether n is a variable, including variables holding a channel.
+func isVariable(n *Node) bool {
+	return n.Type == Var || n.Type == Channel
+}
@@ -0,0 +1,195 @@
+package astro
+
+import (
+	"sort"
+	"testing"
+)
+
+// relationEdges returns the sorted string representation of the edges with the given relations.
+func relationEdges(g *Graph, relations ...Relation) []string {
+	var edges []string
+	for _, edge := range g.Edges {
+		for _, r := range relations {
+			if edge.Relation == r {
+				edges = append(edges, edge.String())
+			}
+		}
+	}
+	sort.Strings(edges)
+	return edges
+}
+
+func TestExtractGraphFromAST_DataFlow(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		src      string
+		expected []string
+	}{
+		{
+			name: "assignment chain into a library call",
+			src: `
+package main
+func main() {
+	a := os.Getenv("CMD")
+	var b string
+	b = a + " -v"
+	exec.Command(b)
+}`,
+			expected: []string{
+				"(a)-[:Assigns]->(b)",
+				"(b)-[:PassesTo]->(exec.Command)",
+				"(os.Getenv)-[:Assigns]->(a)",
+			},
+		},
+		{
+			name: "arguments to declared parameters",
+			src: `
+package main
+func main() {
+	a := 1
+	f(a, a)
+}
+func f(x, y int) {}`,
+			expected: []string{
+				"(a)-[:PassesTo]->(x)",
+				"(a)-[:PassesTo]->(y)",
+			},
+		},
+		{
+			name: "variadic parameter",
+			src: `
+package main
+func main() {
+	a, b := 1, 2
+	sum(a, b)
+}
+func sum(xs ...int) {}`,
+			expected: []string{
+				"(a)-[:PassesTo]->(xs)",
+				"(b)-[:PassesTo]->(xs)",
+			},
+		},
+		{
+			name: "returned expressions and tuple assignment",
+			src: `
+package main
+func double(p int) int {
+	q := p * 2
+	return q
+}
+func main() {
+	r, err := load()
+	double(r)
+	_ = err
+}`,
+			expected: []string{
+				"(load)-[:Assigns]->(err)",
+				"(load)-[:Assigns]->(r)",
+				"(p)-[:Assigns]->(q)",
+				"(q)-[:Return]->(double)",
+				"(r)-[:PassesTo]->(p)",
+			},
+		},
+		{
+			name: "named results",
+			src: `
+package main
+func count() (n int) {
+	n = 1
+	return
+}`,
+			expected: []string{
+				"(n)-[:Return]->(count)",
+			},
+		},
+		{
+			name: "field and index writes",
+			src: `
+package main
+func main() {
+	var cfg Config
+	var xs []int
+	v := 1
+	cfg.Timeout = v
+	xs[0] = v
+}`,
+			expected: []string{
+				"(v)-[:Assigns]->(cfg)",
+				"(v)-[:Assigns]->(xs)",
+			},
+		},
+		{
+			name: "package and unresolved variables",
+			src: `
+package main
+import "os"
+func main() {
+	v := "x"
+	os.Args = nil
+	os.Args[0] = v
+	undefined = v
+}`,
+			expected: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			graph, err := ExtractGraphFromAST(tc.src)
+			if err != nil {
+				t.Fatalf("Error extracting graph: %s", err)
+			}
+
+			got := relationEdges(graph, Assigns, PassesTo, Return)
+			if len(got) != len(tc.expected) {
+				t.Fatalf("Expected edges %v, got %v", tc.expected, got)
+			}
+			for i := range got {
+				if got[i] != tc.expected[i] {
+					t.Errorf("Expected edge %s, got %s", tc.expected[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGraph_DefUseChains(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+func main() {
+	x := source()
+	y := x
+	sink(x, y)
+}`
+
+	graph, err := ExtractGraphFromAST(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	chains := graph.DefUseChains()
+	if len(chains) != 2 {
+		t.Fatalf("Expected 2 def-use chains, got %d", len(chains))
+	}
+
+	x, y := chains[0], chains[1]
+	if x.Var.Name != "x" || y.Var.Name != "y" {
+		t.Fatalf("Expected chains for x and y, got %s and %s", x.Var, y.Var)
+	}
+	if len(x.Defs) != 1 || x.Defs[0].From.Name != "source" {
+		t.Errorf("Expected x to be defined by source, got %v", x.Defs)
+	}
+	if len(x.Uses) != 2 {
+		t.Errorf("Expected x to be used twice, got %v", x.Uses)
+	}
+	if len(y.Defs) != 1 || y.Defs[0].From != x.Var {
+		t.Errorf("Expected y to be defined by x, got %v", y.Defs)
+	}
+	if x.Defs[0].Attr("pos") != "4:7" {
+		t.Errorf("Expected definition of x at 4:7, got %q", x.Defs[0].Attr("pos"))
+	}
+}
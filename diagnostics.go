@@ -0,0 +1,154 @@
+package astro
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// Severity tells how much a diagnostic affects the extracted graph.
+type Severity int
+
+const (
+	SeverityInfo    Severity = iota // the graph is complete, but less precise
+	SeverityWarning                 // the graph lacks nodes or edges
+	SeverityError                   // part of the source could not be extracted at all
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// DiagnosticKind classifies diagnostics.
+type DiagnosticKind string
+
+const (
+	DiagnosticSyntax      DiagnosticKind = "syntax"      // source that could not be parsed
+	DiagnosticUnresolved  DiagnosticKind = "unresolved"  // identifier or import that could not be resolved
+	DiagnosticType        DiagnosticKind = "type"        // any other type error
+	DiagnosticUnsupported DiagnosticKind = "unsupported" // construct the extraction does not support
+	DiagnosticDynamic     DiagnosticKind = "dynamic"     // call whose callee is named after its expression
+	DiagnosticSkipped     DiagnosticKind = "skipped"     // file left out of the extraction
+)
+
+// Diagnostic is a problem met while extracting a graph, such as a construct the
+// extraction does not support. Extraction carries on past diagnostics, so the graph
+// lacks what they report about.
+type Diagnostic struct {
+	Pos      string
+	Severity Severity
+	Kind     DiagnosticKind
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	if d.Pos == "" {
+		return fmt.Sprintf("%s: %s: %s", d.Severity, d.Kind, d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s: %s", d.Pos, d.Severity, d.Kind, d.Message)
+}
+
+// Mode tells how an extraction handles diagnostics.
+type Mode int
+
+const (
+	Lenient Mode = iota // extract as much as possible, including files with syntax errors
+	Strict              // fail on any diagnostic of severity warning or error
+)
+
+// DiagnosticError is returned by a strict extraction, with the diagnostics that made it fail.
+type DiagnosticError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *DiagnosticError) Error() string {
+	messages := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		messages[i] = d.String()
+	}
+	return fmt.Sprintf("extraction failed with %d diagnostics:\n%s", len(e.Diagnostics), strings.Join(messages, "\n"))
+}
+
+// checkMode returns a DiagnosticError if graph has diagnostics failing the mode.
+func checkMode(graph *Graph, mode Mode) error {
+	if mode != Strict {
+		return nil
+	}
+
+	var failed []Diagnostic
+	for _, d := range graph.Diagnostics {
+		if d.Severity >= SeverityWarning {
+			failed = append(failed, d)
+		}
+	}
+	if len(failed) > 0 {
+		return &DiagnosticError{Diagnostics: failed}
+	}
+	return nil
+}
+
+// diagnose records a diagnostic in the graph.
+func (e *extractor) diagnose(pos token.Pos, severity Severity, kind DiagnosticKind, format string, args ...any) {
+	d := Diagnostic{
+		Severity: severity,
+		Kind:     kind,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	if pos.IsValid() {
+		d.Pos = e.fset.Position(pos).String()
+	}
+	e.graph.Diagnostics = append(e.graph.Diagnostics, d)
+}
+
+// syntaxDiagnostics records the errors of a parser as diagnostics of graph.
+func syntaxDiagnostics(graph *Graph, err error) {
+	list, ok := err.(scanner.ErrorList)
+	if !ok {
+		graph.Diagnostics = append(graph.Diagnostics, Diagnostic{Severity: SeverityError, Kind: DiagnosticSyntax, Message: err.Error()})
+		return
+	}
+
+	for _, e := range list {
+		graph.Diagnostics = append(graph.Diagnostics, Diagnostic{
+			Pos:      e.Pos.String(),
+			Severity: SeverityError,
+			Kind:     DiagnosticSyntax,
+			Message:  e.Msg,
+		})
+	}
+}
+
+// skippedFile returns the diagnostic of a file exceeding the maximum file size.
+func skippedFile(path string, size, max int64) Diagnostic {
+	return Diagnostic{
+		Pos:      path,
+		Severity: SeverityWarning,
+		Kind:     DiagnosticSkipped,
+		Message:  fmt.Sprintf("file of %d bytes exceeds the maximum size of %d bytes", size, max),
+	}
+}
+
+// typeDiagnostics records the type errors found in the extracted package.
+//
+// Type errors do not prevent the extraction, but identifiers and imports that cannot
+// be resolved lack the type information some relations rely on.
+func (e *extractor) typeDiagnostics(errs []types.Error) {
+	for _, err := range errs {
+		kind := DiagnosticType
+		if strings.HasPrefix(err.Msg, "undefined:") || strings.HasPrefix(err.Msg, "could not import") {
+			kind = DiagnosticUnresolved
+		}
+		e.diagnose(err.Pos, SeverityWarning, kind, "%s", err.Msg)
+	}
+}
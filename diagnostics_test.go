@@ -0,0 +1,90 @@
+package astro
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExtractGraphWithMode(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+
+import "example.com/missing"
+
+func main() {
+	missing.Run()
+	var = 1
+}
+
+func other() {
+	println("still extracted")
+}
+`
+
+	// a file with syntax errors fails to be extracted by default
+	if _, err := ExtractGraphFromAST(src); err == nil {
+		t.Errorf("Expected a parse error")
+	}
+
+	graph, err := ExtractGraphWithMode(src, Lenient)
+	if err != nil {
+		t.Fatalf("Expected a partial graph, got %s", err)
+	}
+	if graph.NodeMap["other"] == nil {
+		t.Errorf("Expected the function following the syntax error to be extracted")
+	}
+
+	kinds := make(map[DiagnosticKind]int)
+	for _, d := range graph.Diagnostics {
+		kinds[d.Kind]++
+		if d.Kind == DiagnosticSyntax && (d.Severity != SeverityError || d.Pos == "") {
+			t.Errorf("Expected syntax errors to be positioned errors, got %s", d)
+		}
+	}
+	if kinds[DiagnosticSyntax] == 0 {
+		t.Errorf("Expected syntax diagnostics, got %v", graph.Diagnostics)
+	}
+	if kinds[DiagnosticUnresolved] == 0 {
+		t.Errorf("Expected the missing import to be unresolved, got %v", graph.Diagnostics)
+	}
+
+	_, err = ExtractGraphWithMode(src, Strict)
+	var diagErr *DiagnosticError
+	if !errors.As(err, &diagErr) {
+		t.Fatalf("Expected a DiagnosticError, got %v", err)
+	}
+	for _, d := range diagErr.Diagnostics {
+		if d.Severity < SeverityWarning {
+			t.Errorf("Expected only warnings and errors to fail, got %s", d)
+		}
+	}
+}
+
+func TestExtractGraphWithMode_Strict(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+
+func main() {
+	handlers := map[string]func(){}
+	handlers["index"]()
+}
+`
+
+	// informational diagnostics do not fail a strict extraction
+	graph, err := ExtractGraphWithMode(src, Strict)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(graph.Diagnostics) != 1 || graph.Diagnostics[0].Severity != SeverityInfo || graph.Diagnostics[0].Kind != DiagnosticDynamic {
+		t.Errorf("Expected a dynamic call diagnostic, got %v", graph.Diagnostics)
+	}
+
+	expected := `6:2: info: dynamic: callee of handlers["index"] named after its expression`
+	if len(graph.Diagnostics) == 1 && graph.Diagnostics[0].String() != expected {
+		t.Errorf("Expected %q, got %q", expected, graph.Diagnostics[0])
+	}
+}
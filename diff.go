@@ -0,0 +1,461 @@
+package astro
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AttrChange is the change of an attribute of a node or edge found in both graphs of a
+// diff. An attribute missing from a graph has an empty value.
+type AttrChange struct {
+	Key    string
+	Before string
+	After  string
+}
+
+// NodeChange is a node found in both graphs of a diff, with different attributes.
+type NodeChange struct {
+	Before *Node
+	After  *Node
+	Attrs  []AttrChange // sorted by key
+}
+
+// EdgeChange is an edge found in both graphs of a diff, with different attributes.
+type EdgeChange struct {
+	Before *Edge
+	After  *Edge
+	Attrs  []AttrChange // sorted by key
+}
+
+// GraphDiff is the difference between two graphs, such as the graphs of two revisions
+// of the same tree. Added nodes and edges belong to the graph after the change, and
+// removed ones to the graph before it.
+type GraphDiff struct {
+	AddedNodes   []*Node
+	RemovedNodes []*Node
+	ChangedNodes []*NodeChange
+	AddedEdges   []*Edge
+	RemovedEdges []*Edge
+	ChangedEdges []*EdgeChange
+
+	ids   map[*Node]string // identities of the nodes of both graphs
+	after map[string]*Node // nodes of the graph after the change by identity
+}
+
+// Diff returns the difference between the graphs before and after a change.
+//
+// Nodes are matched by their qualified identity: their type and name, the names of
+// variables, constants and types being qualified by the function or package declaring
+// them, so that the variables sharing a name in different functions are kept apart.
+// Function literals are matched by their order in the enclosing function, since their
+// names hold their position. Edges are matched by their relation and the identities of
+// their nodes, parallel edges in order.
+//
+// Positions are ignored when comparing attributes, since they move with every edit above
+// them; the other attributes are reported as changed.
+func Diff(before, after *Graph) *GraphDiff {
+	beforeIDs, afterIDs := identities(before), identities(after)
+	d := &GraphDiff{ids: make(map[*Node]string, len(beforeIDs)+len(afterIDs))}
+	for _, ids := range []map[*Node]string{beforeIDs, afterIDs} {
+		for node, id := range ids {
+			d.ids[node] = id
+		}
+	}
+
+	beforeNodes := make(map[string]*Node)
+	for _, node := range before.Nodes {
+		beforeNodes[beforeIDs[node]] = node
+	}
+	afterNodes := make(map[string]*Node)
+	for _, node := range after.Nodes {
+		id := afterIDs[node]
+		afterNodes[id] = node
+		old, exists := beforeNodes[id]
+		if !exists {
+			d.AddedNodes = append(d.AddedNodes, node)
+			continue
+		}
+		if attrs := attrChanges(old.Attrs, node.Attrs); len(attrs) > 0 {
+			d.ChangedNodes = append(d.ChangedNodes, &NodeChange{Before: old, After: node, Attrs: attrs})
+		}
+	}
+	for _, node := range before.Nodes {
+		if _, exists := afterNodes[beforeIDs[node]]; !exists {
+			d.RemovedNodes = append(d.RemovedNodes, node)
+		}
+	}
+	d.after = afterNodes
+
+	edgeKey := func(ids map[*Node]string, e *Edge) string {
+		return ids[e.From] + " " + string(e.Relation) + " " + ids[e.To]
+	}
+	beforeEdges := make(map[string][]*Edge)
+	for _, edge := range before.Edges {
+		key := edgeKey(beforeIDs, edge)
+		beforeEdges[key] = append(beforeEdges[key], edge)
+	}
+	matched := make(map[string]int)
+	for _, edge := range after.Edges {
+		key := edgeKey(afterIDs, edge)
+		i := matched[key]
+		matched[key]++
+		if i >= len(beforeEdges[key]) {
+			d.AddedEdges = append(d.AddedEdges, edge)
+			continue
+		}
+		old := beforeEdges[key][i]
+		if attrs := attrChanges(old.Attrs, edge.Attrs); len(attrs) > 0 {
+			d.ChangedEdges = append(d.ChangedEdges, &EdgeChange{Before: old, After: edge, Attrs: attrs})
+		}
+	}
+	for _, edge := range before.Edges {
+		key := edgeKey(beforeIDs, edge)
+		if matched[key] > 0 {
+			matched[key]--
+			continue
+		}
+		d.RemovedEdges = append(d.RemovedEdges, edge)
+	}
+
+	return d
+}
+
+// Empty reports whether the graphs of the diff are the same.
+func (d *GraphDiff) Empty() bool {
+	return len(d.AddedNodes) == 0 && len(d.RemovedNodes) == 0 && len(d.ChangedNodes) == 0 &&
+		len(d.AddedEdges) == 0 && len(d.RemovedEdges) == 0 && len(d.ChangedEdges) == 0
+}
+
+// locallyNamed holds the types of the nodes named after an identifier, whose identity
+// is qualified by the node declaring them.
+var locallyNamed = map[NodeType]bool{
+	Var:       true,
+	Const:     true,
+	TypeDecl:  true,
+	TypeParam: true,
+	Channel:   true,
+	Mutex:     true,
+}
+
+// identities returns the qualified identity of every node of g. Nodes sharing an
+// identity, such as two variables declared with the same name in a function, are told
+// apart by their order in the graph.
+func identities(g *Graph) map[*Node]string {
+	declarers := make(map[*Node]*Node)
+	for _, edge := range g.Edges {
+		if edge.Relation == Declares {
+			if _, exists := declarers[edge.To]; !exists {
+				declarers[edge.To] = edge.From
+			}
+		}
+	}
+
+	names := make(map[*Node]string)
+	var qualified func(n *Node, depth int) string
+	qualified = func(n *Node, depth int) string {
+		if name, ok := names[n]; ok {
+			return name
+		}
+
+		name := n.Name
+		switch {
+		case n.Type == FuncLit:
+			if i := strings.LastIndex(name, "@"); i >= 0 {
+				name = name[:i]
+			}
+		case locallyNamed[n.Type]:
+			// declarations are not cyclic, but a malformed graph may be
+			if declarer, ok := declarers[n]; ok && declarer.Name != "" && depth < len(g.Nodes) {
+				name = qualified(declarer, depth+1) + "." + name
+			}
+		}
+
+		names[n] = name
+		return name
+	}
+
+	ids := make(map[*Node]string)
+	seen := make(map[string]int)
+	for _, node := range g.Nodes {
+		if _, exists := ids[node]; exists {
+			continue
+		}
+		id := string(node.Type) + " " + qualified(node, 0)
+		seen[id]++
+		if seen[id] > 1 {
+			id += "#" + strconv.Itoa(seen[id])
+		}
+		ids[node] = id
+	}
+	// nodes missing from the node list are only known through their edges
+	for _, edge := range g.Edges {
+		for _, node := range []*Node{edge.From, edge.To} {
+			if _, exists := ids[node]; !exists {
+				ids[node] = string(node.Type) + " " + qualified(node, 0)
+			}
+		}
+	}
+
+	return ids
+}
+
+// positionAttrs holds the attributes holding a position, ignored by a diff.
+var positionAttrs = map[string]bool{
+	"pos": true,
+	"end": true,
+}
+
+// attrChanges returns the changes of the attributes but the positions from before to after.
+func attrChanges(before, after map[string]string) []AttrChange {
+	var changes []AttrChange
+	for key, value := range before {
+		if !positionAttrs[key] && after[key] != value {
+			changes = append(changes, AttrChange{Key: key, Before: value, After: after[key]})
+		}
+	}
+	for key, value := range after {
+		if _, exists := before[key]; !exists && !positionAttrs[key] {
+			changes = append(changes, AttrChange{Key: key, After: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+func (c AttrChange) String() string {
+	return fmt.Sprintf("%s: %q -> %q", c.Key, c.Before, c.After)
+}
+
+func attrChangesString(changes []AttrChange) string {
+	parts := make([]string, len(changes))
+	for i, c := range changes {
+		parts[i] = c.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// String formats the diff as text, one line per change: "+" for the nodes and edges
+// added, "-" for the removed ones and "~" for the changed ones, e.g.
+//
+//	fmt.Print(Diff(before, after))
+//	+ Function (main.check)
+//	~ Variable (x) type: "int" -> "string"
+//	+ (main.main)-[:Call]->(main.check)
+func (d *GraphDiff) String() string {
+	var b strings.Builder
+	for _, node := range d.RemovedNodes {
+		fmt.Fprintf(&b, "- %s %s\n", node.Type, node)
+	}
+	for _, node := range d.AddedNodes {
+		fmt.Fprintf(&b, "+ %s %s\n", node.Type, node)
+	}
+	for _, c := range d.ChangedNodes {
+		fmt.Fprintf(&b, "~ %s %s %s\n", c.After.Type, c.After, attrChangesString(c.Attrs))
+	}
+	for _, edge := range d.RemovedEdges {
+		fmt.Fprintf(&b, "- %s\n", edge)
+	}
+	for _, edge := range d.AddedEdges {
+		fmt.Fprintf(&b, "+ %s\n", edge)
+	}
+	for _, c := range d.ChangedEdges {
+		fmt.Fprintf(&b, "~ %s %s\n", c.After, attrChangesString(c.Attrs))
+	}
+	return b.String()
+}
+
+// diffNode and diffEdge are the JSON forms of the nodes and edges of a diff.
+type diffNode struct {
+	Type  NodeType          `json:"type"`
+	Name  string            `json:"name"`
+	Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+type diffEdge struct {
+	From     diffNode          `json:"from"`
+	Relation Relation          `json:"relation"`
+	To       diffNode          `json:"to"`
+	Attrs    map[string]string `json:"attrs,omitempty"`
+}
+
+type diffAttr struct {
+	Key    string `json:"key"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+type diffNodeChange struct {
+	diffNode
+	Changes []diffAttr `json:"changes"`
+}
+
+type diffEdgeChange struct {
+	diffEdge
+	Changes []diffAttr `json:"changes"`
+}
+
+// MarshalJSON formats the diff as JSON, with the lists "added_nodes", "removed_nodes",
+// "changed_nodes", "added_edges", "removed_edges" and "changed_edges".
+func (d *GraphDiff) MarshalJSON() ([]byte, error) {
+	node := func(n *Node) diffNode {
+		return diffNode{Type: n.Type, Name: n.Name, Attrs: n.Attrs}
+	}
+	edge := func(e *Edge) diffEdge {
+		return diffEdge{From: node(e.From), Relation: e.Relation, To: node(e.To), Attrs: e.Attrs}
+	}
+	attrs := func(changes []AttrChange) []diffAttr {
+		result := make([]diffAttr, len(changes))
+		for i, c := range changes {
+			result[i] = diffAttr(c)
+		}
+		return result
+	}
+
+	out := struct {
+		AddedNodes   []diffNode       `json:"added_nodes"`
+		RemovedNodes []diffNode       `json:"removed_nodes"`
+		ChangedNodes []diffNodeChange `json:"changed_nodes"`
+		AddedEdges   []diffEdge       `json:"added_edges"`
+		RemovedEdges []diffEdge       `json:"removed_edges"`
+		ChangedEdges []diffEdgeChange `json:"changed_edges"`
+	}{
+		AddedNodes:   []diffNode{},
+		RemovedNodes: []diffNode{},
+		ChangedNodes: []diffNodeChange{},
+		AddedEdges:   []diffEdge{},
+		RemovedEdges: []diffEdge{},
+		ChangedEdges: []diffEdgeChange{},
+	}
+	for _, n := range d.AddedNodes {
+		out.AddedNodes = append(out.AddedNodes, node(n))
+	}
+	for _, n := range d.RemovedNodes {
+		out.RemovedNodes = append(out.RemovedNodes, node(n))
+	}
+	for _, c := range d.ChangedNodes {
+		out.ChangedNodes = append(out.ChangedNodes, diffNodeChange{node(c.After), attrs(c.Attrs)})
+	}
+	for _, e := range d.AddedEdges {
+		out.AddedEdges = append(out.AddedEdges, edge(e))
+	}
+	for _, e := range d.RemovedEdges {
+		out.RemovedEdges = append(out.RemovedEdges, edge(e))
+	}
+	for _, c := range d.ChangedEdges {
+		out.ChangedEdges = append(out.ChangedEdges, diffEdgeChange{edge(c.After), attrs(c.Attrs)})
+	}
+
+	return json.Marshal(out)
+}
+
+// Colors of the DOT form of a diff.
+const (
+	dotAdded     = "darkgreen"
+	dotRemoved   = "red"
+	dotChanged   = "orange"
+	dotUnchanged = "gray"
+)
+
+// DOT formats the diff as a Graphviz graph of the changed nodes and edges, with the
+// nodes connected by a changed edge: added ones in green, removed ones in red, changed
+// ones in orange and unchanged ones in gray.
+func (d *GraphDiff) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph diff {\n")
+
+	// nodes are matched by identity, so that an edge removed and an edge added share
+	// their unchanged nodes
+	ids := make(map[string]string)
+	node := func(n *Node, color string) string {
+		id := d.ids[n]
+		if id == "" {
+			id = string(n.Type) + " " + n.Name
+		}
+		if dot, exists := ids[id]; exists {
+			return dot
+		}
+		ids[id] = "n" + strconv.Itoa(len(ids))
+		fmt.Fprintf(&b, "\t%s [label=%s, color=%s, fontcolor=%s];\n",
+			ids[id], strconv.Quote(string(n.Type)+"\n"+n.Name), color, color)
+		return ids[id]
+	}
+	edge := func(e *Edge, color, label string) {
+		from, to := node(e.From, dotUnchanged), node(e.To, dotUnchanged)
+		fmt.Fprintf(&b, "\t%s -> %s [label=%s, color=%s, fontcolor=%s];\n",
+			from, to, strconv.Quote(label), color, color)
+	}
+
+	for _, n := range d.RemovedNodes {
+		node(n, dotRemoved)
+	}
+	for _, n := range d.AddedNodes {
+		node(n, dotAdded)
+	}
+	for _, c := range d.ChangedNodes {
+		node(c.After, dotChanged)
+	}
+	for _, e := range d.RemovedEdges {
+		edge(e, dotRemoved, string(e.Relation))
+	}
+	for _, e := range d.AddedEdges {
+		edge(e, dotAdded, string(e.Relation))
+	}
+	for _, c := range d.ChangedEdges {
+		edge(c.After, dotChanged, string(c.After.Relation)+"\n"+attrChangesString(c.Attrs))
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// DiffDirs extracts the graphs of the trees under the directories before and after, like
+// ExtractGraphFromDir, and returns their difference.
+func DiffDirs(before, after string) (*GraphDiff, error) {
+	g1, err := ExtractGraphFromDir(before)
+	if err != nil {
+		return nil, err
+	}
+	g2, err := ExtractGraphFromDir(after)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(g1, g2), nil
+}
+
+// DiffRevisions extracts the graphs of two revisions of the git repository at repo, such
+// as two commits or branches, and returns their difference. Each revision is checked out
+// into a temporary worktree, removed once extracted.
+func DiffRevisions(repo, before, after string) (*GraphDiff, error) {
+	g1, err := extractRevision(repo, before)
+	if err != nil {
+		return nil, err
+	}
+	g2, err := extractRevision(repo, after)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(g1, g2), nil
+}
+
+// extractRevision extracts the graph of a revision of the git repository at repo.
+func extractRevision(repo, rev string) (*Graph, error) {
+	dir, err := os.MkdirTemp("", "astro-worktree-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating worktree: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if out, err := exec.Command("git", "-C", repo, "worktree", "add", "--detach", dir, rev).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("error checking out %s: %s: %s", rev, err, strings.TrimSpace(string(out)))
+	}
+	defer exec.Command("git", "-C", repo, "worktree", "remove", "--force", dir).Run()
+
+	return ExtractGraphFromDir(dir)
+}
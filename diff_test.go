@@ -0,0 +1,203 @@
+package astro
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const diffBefore = `
+package main
+
+func main() {
+	x := 1
+	helper(x)
+	go func() {}()
+}
+
+func helper(n int) {
+	x := n
+	_ = x
+}
+
+func old() {}
+`
+
+// the function literal and every declaration moved by a line
+const diffAfter = `
+package main
+
+func main() {
+	x := "1"
+	_ = x
+	helper(2)
+
+	go func() {}()
+	check()
+}
+
+func helper(n int) {
+	x := n
+	_ = x
+}
+
+func check() {}
+`
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	before, err := ExtractGraphFromAST(diffBefore)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+	after, err := ExtractGraphFromAST(diffAfter)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	d := Diff(before, after)
+	expected := []string{
+		"- Function (old)",
+		"+ Function (check)",
+		`~ Variable (x) type: "int" -> "string"`,
+		"- (x)-[:PassesTo]->(n)",
+		"- (main)-[:Declares]->(old)",
+		"+ (main)-[:Call]->(check)",
+		"+ (main)-[:Declares]->(check)",
+	}
+	got := strings.Split(strings.TrimSuffix(d.String(), "\n"), "\n")
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d changes, got %d:\n%s", len(expected), len(got), d)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], got[i])
+		}
+	}
+
+	if !Diff(after, after).Empty() {
+		t.Errorf("Expected no difference between a graph and itself, got:\n%s", Diff(after, after))
+	}
+}
+
+func TestGraphDiff_Formats(t *testing.T) {
+	t.Parallel()
+
+	before, err := ExtractGraphFromAST(diffBefore)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+	after, err := ExtractGraphFromAST(diffAfter)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+	d := Diff(before, after)
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("Error marshaling diff: %s", err)
+	}
+	var decoded struct {
+		AddedNodes []struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+		} `json:"added_nodes"`
+		ChangedNodes []struct {
+			Name    string `json:"name"`
+			Changes []struct {
+				Key    string `json:"key"`
+				Before string `json:"before"`
+				After  string `json:"after"`
+			} `json:"changes"`
+		} `json:"changed_nodes"`
+		RemovedEdges []struct {
+			Relation string `json:"relation"`
+		} `json:"removed_edges"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling diff: %s", err)
+	}
+	if len(decoded.AddedNodes) != 1 || decoded.AddedNodes[0].Name != "check" || decoded.AddedNodes[0].Type != "Function" {
+		t.Errorf("Expected check to be added, got %s", data)
+	}
+	if len(decoded.ChangedNodes) != 1 || len(decoded.ChangedNodes[0].Changes) != 1 || decoded.ChangedNodes[0].Changes[0].After != "string" {
+		t.Errorf("Expected the type of x to change, got %s", data)
+	}
+	if len(decoded.RemovedEdges) != 2 {
+		t.Errorf("Expected 2 removed edges, got %s", data)
+	}
+
+	dot := d.DOT()
+	for _, expected := range []string{
+		"digraph diff {",
+		`[label="Function\ncheck", color=darkgreen, fontcolor=darkgreen]`,
+		`[label="Function\nold", color=red, fontcolor=red]`,
+		`[label="Variable\nx", color=orange, fontcolor=orange]`,
+		`[label="Call", color=darkgreen, fontcolor=darkgreen]`,
+	} {
+		if !strings.Contains(dot, expected) {
+			t.Errorf("Expected the DOT graph to contain %s, got:\n%s", expected, dot)
+		}
+	}
+	// main is drawn once, for both its removed and added edges
+	if count := strings.Count(dot, `label="Function\nmain"`); count != 1 {
+		t.Errorf("Expected main to be drawn once, got %d times:\n%s", count, dot)
+	}
+}
+
+func TestDiffRevisions(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.21\n",
+		"main.go": `package main
+
+func main() {}
+`,
+	})
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", root, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("Error running git %s: %s: %s", strings.Join(args, " "), err, out)
+		}
+	}
+	git("init", "-q")
+	git("add", "-A")
+	git("commit", "-q", "-m", "before")
+	src := `package main
+
+func main() {
+	run()
+}
+
+func run() {}
+`
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	git("commit", "-q", "-a", "-m", "after")
+
+	d, err := DiffRevisions(root, "HEAD~1", "HEAD")
+	if err != nil {
+		t.Fatalf("Error diffing revisions: %s", err)
+	}
+	if len(d.AddedNodes) != 1 || d.AddedNodes[0].Name != "example.com/app.run" {
+		t.Errorf("Expected run to be added, got:\n%s", d)
+	}
+	if len(d.RemovedNodes) != 0 {
+		t.Errorf("Expected no removed nodes, got:\n%s", d)
+	}
+
+	if _, err := DiffRevisions(root, "HEAD", "missing"); err == nil {
+		t.Error("Expected an error diffing a missing revision")
+	}
+}
@@ -0,0 +1,335 @@
+package astro
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// ErrorStatus tells what happens to the error returned by a call.
+type ErrorStatus string
+
+const (
+	ErrorChecked  ErrorStatus = "checked"  // inspected, e.g. compared to nil, or passed to another function
+	ErrorReturned ErrorStatus = "returned" // returned to the caller as is
+	ErrorWrapped  ErrorStatus = "wrapped"  // wrapped with fmt.Errorf("...: %w", err) or errors.Join
+	ErrorDropped  ErrorStatus = "dropped"  // discarded, assigned to _, or overwritten before being used
+)
+
+// ignoredErrors lists the functions whose error is not followed: functions creating
+// errors rather than failing, whose result is not an error without context, and printing
+// functions whose error is conventionally ignored.
+var ignoredErrors = map[string]bool{
+	"errors.New":  true,
+	"errors.Join": true,
+	"fmt.Errorf":  true,
+	"fmt.Print":   true,
+	"fmt.Printf":  true,
+	"fmt.Println": true,
+}
+
+// errorFlow records, for every call of decl returning an error, what happens to that error.
+//
+// The status of the error is set in the "error" attribute of the edge extracted from the
+// call, and the variable the error is assigned to, if any, in the "errvar" attribute.
+// An error assigned to a variable is followed through the uses of the variable until it
+// is assigned again, regardless of the control flow. The strongest use wins: an error
+// wrapped on a path and returned on another one is wrapped.
+func (e *extractor) errorFlow(decl *ast.FuncDecl) {
+	if decl.Body == nil {
+		return
+	}
+
+	parents := make(map[ast.Node]ast.Node)
+	uses := make(map[*ast.Object][]*ast.Ident)
+	var returns []*ast.ReturnStmt
+	var calls []*ast.CallExpr
+	var stack []ast.Node
+	ast.Inspect(decl.Body, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		if len(stack) > 0 {
+			parents[n] = stack[len(stack)-1]
+		}
+		stack = append(stack, n)
+
+		switch x := n.(type) {
+		case *ast.Ident:
+			if x.Obj != nil && x.Obj.Kind == ast.Var {
+				uses[x.Obj] = append(uses[x.Obj], x)
+			}
+		case *ast.ReturnStmt:
+			returns = append(returns, x)
+		case *ast.CallExpr:
+			calls = append(calls, x)
+		}
+		return true
+	})
+
+	flow := &errorFlow{e: e, parents: parents, uses: uses, returns: returns}
+	for _, call := range calls {
+		edge, ok := e.callEdges[call]
+		if !ok {
+			continue
+		}
+
+		index := e.errorResult(call)
+		if index < 0 || ignoredErrors[edge.To.Name[strings.LastIndex(edge.To.Name, "/")+1:]] {
+			continue
+		}
+
+		status, errVar := flow.call(call, index)
+		edge.SetAttr("error", string(status))
+		if errVar != nil {
+			edge.SetAttr("errvar", errVar.Name)
+		}
+	}
+}
+
+// errorResult returns the index of the error among the results of call, or -1 if it
+// does not return an error.
+func (e *extractor) errorResult(call *ast.CallExpr) int {
+	if tv, ok := e.info.Types[call.Fun]; ok && tv.IsType() {
+		return -1 // conversion
+	}
+
+	tv, ok := e.info.Types[call]
+	if !ok {
+		return -1
+	}
+	if tuple, ok := tv.Type.(*types.Tuple); ok {
+		for i := tuple.Len() - 1; i >= 0; i-- {
+			if isError(tuple.At(i).Type()) {
+				return i
+			}
+		}
+		return -1
+	}
+	if isError(tv.Type) {
+		return 0
+	}
+	return -1
+}
+
+// errorFlow holds the syntax of a function needed to follow its errors.
+type errorFlow struct {
+	e       *extractor
+	parents map[ast.Node]ast.Node
+	uses    map[*ast.Object][]*ast.Ident
+	returns []*ast.ReturnStmt
+}
+
+// parent returns the parent of n, skipping parentheses.
+func (f *errorFlow) parent(n ast.Node) ast.Node {
+	p := f.parents[n]
+	for {
+		paren, ok := p.(*ast.ParenExpr)
+		if !ok {
+			return p
+		}
+		p = f.parents[paren]
+	}
+}
+
+// call returns the status of the error returned at the given index of the results of
+// call, and the variable it is assigned to.
+func (f *errorFlow) call(call *ast.CallExpr, index int) (ErrorStatus, *ast.Ident) {
+	switch p := f.parent(call).(type) {
+	case *ast.ExprStmt, *ast.GoStmt, *ast.DeferStmt:
+		return ErrorDropped, nil
+	case *ast.ReturnStmt:
+		return ErrorReturned, nil
+	case *ast.CallExpr:
+		if f.e.wraps(p) {
+			return ErrorWrapped, nil
+		}
+		return ErrorChecked, nil
+	case *ast.AssignStmt:
+		return f.assigned(call, index, p.Lhs, p.Rhs, p)
+	case *ast.ValueSpec:
+		return f.assigned(call, index, exprList(p.Names), p.Values, p)
+	}
+
+	return ErrorChecked, nil
+}
+
+// assigned returns the status of an error assigned by stmt to one of lhs.
+func (f *errorFlow) assigned(call *ast.CallExpr, index int, lhs, rhs []ast.Expr, stmt ast.Node) (ErrorStatus, *ast.Ident) {
+	var target ast.Expr
+	if len(rhs) == 1 && index < len(lhs) {
+		target = lhs[index]
+	} else {
+		for i, r := range rhs {
+			if r == call && i < len(lhs) {
+				target = lhs[i]
+			}
+		}
+	}
+
+	ident, ok := target.(*ast.Ident)
+	switch {
+	case target == nil || !ok:
+		return ErrorChecked, nil // stored elsewhere, e.g. in a struct field
+	case ident.Name == "_":
+		return ErrorDropped, ident
+	case ident.Obj == nil:
+		return ErrorChecked, ident
+	}
+
+	return f.variable(ident.Obj, stmt.End()), ident
+}
+
+// variable returns the status of the error held by obj from the given position until
+// it is assigned again.
+func (f *errorFlow) variable(obj *ast.Object, from token.Pos) ErrorStatus {
+	status := ErrorDropped
+	until := token.NoPos
+	for _, use := range f.uses[obj] {
+		if use.Pos() < from || (until.IsValid() && use.Pos() >= until) {
+			continue
+		}
+
+		switch p := f.parent(use).(type) {
+		case *ast.AssignStmt:
+			if isLhs(use, p.Lhs) {
+				// assigned again: later uses see another error
+				if !until.IsValid() {
+					until = p.End()
+				}
+				continue
+			}
+			if i := indexOf(use, p.Rhs); i >= 0 && len(p.Lhs) == len(p.Rhs) && isBlank(p.Lhs[i]) {
+				continue // _ = err
+			}
+			status = strongest(status, ErrorChecked)
+		case *ast.ReturnStmt:
+			status = strongest(status, ErrorReturned)
+		case *ast.CallExpr:
+			if f.e.wraps(p) && indexOf(use, p.Args) >= 0 {
+				status = strongest(status, ErrorWrapped)
+			} else {
+				status = strongest(status, ErrorChecked)
+			}
+		default:
+			status = strongest(status, ErrorChecked)
+		}
+	}
+
+	// named results are returned by naked returns
+	if node, ok := f.e.objects[obj]; ok && node.Attr("kind") == "result" {
+		for _, ret := range f.returns {
+			if len(ret.Results) == 0 && ret.Pos() >= from && (!until.IsValid() || ret.Pos() < until) {
+				status = strongest(status, ErrorReturned)
+			}
+		}
+	}
+
+	return status
+}
+
+// strongest returns the status of an error given two of its uses.
+func strongest(a, b ErrorStatus) ErrorStatus {
+	rank := map[ErrorStatus]int{ErrorDropped: 0, ErrorChecked: 1, ErrorReturned: 2, ErrorWrapped: 3}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// wraps reports whether call wraps the errors passed to it, with fmt.Errorf and a
+// format containing %w, or with errors.Join.
+func (e *extractor) wraps(call *ast.CallExpr) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	if !ok || pkg.Obj != nil {
+		return false
+	}
+
+	switch e.imports[pkg.Name] + "." + sel.Sel.Name {
+	case "errors.Join":
+		return true
+	case "fmt.Errorf":
+		if len(call.Args) == 0 {
+			return false
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return false
+		}
+		format, err := strconv.Unquote(lit.Value)
+		return err == nil && strings.Contains(format, "%w")
+	}
+	return false
+}
+
+func isLhs(ident *ast.Ident, lhs []ast.Expr) bool {
+	for _, l := range lhs {
+		if l == ident {
+			return true
+		}
+	}
+	return false
+}
+
+func indexOf(ident *ast.Ident, exprs []ast.Expr) int {
+	for i, expr := range exprs {
+		if expr == ident {
+			return i
+		}
+	}
+	return -1
+}
+
+func isBlank(expr ast.Expr) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == "_"
+}
+
+// ErrorFlow is the fate of the error returned by a call.
+type ErrorFlow struct {
+	Call   *Edge       // edge extracted from the call
+	Status ErrorStatus // what happens to the error
+	Var    string      // variable the error is assigned to, if any
+}
+
+func (f *ErrorFlow) String() string {
+	switch f.Status {
+	case ErrorReturned:
+		return fmt.Sprintf("%s: error of %s returned by %s without wrapping", f.Call.Attr("pos"), f.Call.To.Name, f.Call.From.Name)
+	default:
+		return fmt.Sprintf("%s: error of %s %s in %s", f.Call.Attr("pos"), f.Call.To.Name, f.Status, f.Call.From.Name)
+	}
+}
+
+// ErrorFlows returns the fate of the error of every call returning one, in the order
+// the calls appear in the graph. Errors are only known for the calls whose result type
+// could be inferred, which requires the callee package to be importable.
+func ErrorFlows(graph *Graph) []*ErrorFlow {
+	var flows []*ErrorFlow
+	for _, edge := range graph.Edges {
+		if status := edge.Attr("error"); status != "" {
+			flows = append(flows, &ErrorFlow{Call: edge, Status: ErrorStatus(status), Var: edge.Attr("errvar")})
+		}
+	}
+	return flows
+}
+
+// ErrorIssues reports the dropped errors, and the errors returned without wrapping them
+// with context.
+func ErrorIssues(graph *Graph) []*ErrorFlow {
+	var issues []*ErrorFlow
+	for _, flow := range ErrorFlows(graph) {
+		if flow.Status == ErrorDropped || flow.Status == ErrorReturned {
+			issues = append(issues, flow)
+		}
+	}
+	return issues
+}
@@ -0,0 +1,106 @@
+package astro
+
+import (
+	"testing"
+)
+
+func TestErrorFlows(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+func open(name string) (*os.File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", name, err)
+	}
+	return f, nil
+}
+
+func remove(name string) error {
+	return os.Remove(name)
+}
+
+func check(name string) error {
+	_, err := os.Stat(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return errors.New("missing")
+	}
+	return nil
+}
+
+func cleanup(name string) (err error) {
+	err = os.Chdir(name)
+	return
+}
+
+func main() {
+	f, _ := open("a")
+	defer f.Close()
+	remove("a")
+	err := check("a")
+	err = os.Setenv("A", "1")
+	fmt.Println(err)
+}
+`
+
+	graph, err := ExtractGraphFromAST(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	got := make(map[string]ErrorStatus)
+	for _, flow := range ErrorFlows(graph) {
+		got[flow.Call.Attr("pos")] = flow.Status
+	}
+
+	expected := map[string]ErrorStatus{
+		"11:12": ErrorWrapped,  // os.Open
+		"19:9":  ErrorReturned, // os.Remove
+		"23:12": ErrorChecked,  // os.Stat
+		"31:8":  ErrorReturned, // os.Chdir, through the named result
+		"36:10": ErrorDropped,  // open, assigned to _
+		"37:8":  ErrorDropped,  // f.Close
+		"38:2":  ErrorDropped,  // remove
+		"39:9":  ErrorDropped,  // check, overwritten
+		"40:8":  ErrorChecked,  // os.Setenv
+	}
+	if len(got) != len(expected) {
+		t.Errorf("Expected %d calls returning an error, got %v", len(expected), got)
+	}
+	for pos, status := range expected {
+		if got[pos] != status {
+			t.Errorf("Expected the error of the call at %s to be %s, got %q", pos, status, got[pos])
+		}
+	}
+
+	issues := ErrorIssues(graph)
+	if len(issues) != 6 {
+		t.Errorf("Expected 6 issues, got %v", issues)
+	}
+	for _, issue := range issues {
+		if issue.Call.Attr("pos") == "19:9" {
+			expected := "19:9: error of os.Remove returned by remove without wrapping"
+			if issue.String() != expected {
+				t.Errorf("Expected %q, got %q", expected, issue)
+			}
+		}
+	}
+
+	// variables holding an error are marked with their type
+	for _, node := range graph.Nodes {
+		if node.Type == Var && node.Name == "err" && node.Attr("error") != "true" {
+			t.Errorf("Expected err to be marked as an error, got %v", node.Attrs)
+		}
+	}
+	if f := findNode(graph, Var, "f"); f == nil || f.Attr("type") != "*os.File" {
+		t.Errorf("Expected f to be a *os.File, got %v", f)
+	}
+}
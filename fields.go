@@ -0,0 +1,278 @@
+package astro
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// Field accesses are only known with type information, which tells fields apart from
+// methods and package members, and resolves promoted fields to the struct declaring them:
+//
+//	x := s.count     f -[:ReadsField]-> Server.count
+//	s.count++        f -[:WritesField {op: inc}]-> Server.count
+//	s.count += n     f -[:WritesField {op: assign}]-> Server.count
+//	p := &s.count    f -[:WritesField {op: addr}]-> Server.count
+//	s.mu.Lock()      f -[:WritesField {op: addr}]-> Server.mu, for a pointer receiver
+//	s.items[k] = v   f -[:WritesField {op: index}]-> Server.items
+//	Server{count: 1} f -[:WritesField {op: init}]-> Server.count
+//
+// Only the fields of named struct types are extracted. Writes, including increments and
+// compound assignments, are not also reads.
+
+// declareStructFields declares the fields of the struct type declared by spec, with a
+// Declares edge from the type node.
+func (e *extractor) declareStructFields(typeNode *Node, spec *ast.TypeSpec) {
+	st, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		return
+	}
+
+	for _, field := range st.Fields.List {
+		names := field.Names
+		if len(names) == 0 {
+			// embedded field, named after its type
+			if ident := embeddedName(field.Type); ident != nil {
+				names = []*ast.Ident{ident}
+			}
+		}
+		for _, name := range names {
+			v, ok := e.info.Defs[name].(*types.Var)
+			if !ok || name.Name == "_" {
+				continue
+			}
+			node := e.fieldNode(v, typeNode.Name)
+			node.SetAttr("pos", e.fset.Position(name.Pos()).String())
+			node.SetAttr("type", typeString(v.Type()))
+			e.graph.AddEdge(typeNode, node, Declares)
+		}
+	}
+}
+
+// embeddedName returns the identifier naming an embedded field of type expr.
+func embeddedName(expr ast.Expr) *ast.Ident {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		return x
+	case *ast.StarExpr:
+		return embeddedName(x.X)
+	case *ast.SelectorExpr:
+		return x.Sel
+	case *ast.IndexExpr:
+		return embeddedName(x.X)
+	case *ast.IndexListExpr:
+		return embeddedName(x.X)
+	}
+	return nil
+}
+
+// fieldNode returns the node of the field v of the struct type named owner, creating it
+// on its first access. Fields are kept out of the node map, like variables, and are named
+// after their type, e.g. "Server.count".
+func (e *extractor) fieldNode(v *types.Var, owner string) *Node {
+	v = v.Origin()
+	if node, exists := e.fields[v]; exists {
+		return node
+	}
+
+	node := NewNode(Field, owner+"."+v.Name())
+	e.graph.Nodes = append(e.graph.Nodes, node)
+	e.fields[v] = node
+
+	return node
+}
+
+// selectedField returns the node of the field selected by sel, or nil if sel does not
+// select a field of a named struct type.
+func (e *extractor) selectedField(sel *ast.SelectorExpr) *Node {
+	selection, ok := e.info.Selections[sel]
+	if !ok || selection.Kind() != types.FieldVal {
+		return nil
+	}
+
+	owner, field := embeddedField(selection.Recv(), selection.Index())
+	if owner == nil || field == nil {
+		return nil
+	}
+
+	return e.fieldNode(field, e.objectName(owner.Origin().Obj()))
+}
+
+// embeddedField follows the path of field indices from a value of type t, through the
+// embedded fields, to the field it ends at and the named struct type declaring it.
+func embeddedField(t types.Type, path []int) (*types.Named, *types.Var) {
+	var owner *types.Named
+	var field *types.Var
+	for _, index := range path {
+		if ptr, ok := t.Underlying().(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+		owner, _ = t.(*types.Named)
+		st, ok := t.Underlying().(*types.Struct)
+		if !ok || index >= st.NumFields() {
+			return nil, nil
+		}
+		field = st.Field(index)
+		t = field.Type()
+	}
+	return owner, field
+}
+
+// objectName returns the name of obj, a type or a package-level variable, qualified like
+// the functions of the extracted package when declared in it, or else with the name of
+// its package.
+func (e *extractor) objectName(obj types.Object) string {
+	pkg := obj.Pkg()
+	switch {
+	case pkg == nil:
+		return obj.Name()
+	case e.isExtracted(pkg):
+		return e.qualify(obj.Name())
+	case e.qualification == QualifyPath:
+		return pkg.Path() + "." + obj.Name()
+	default:
+		return pkg.Name() + "." + obj.Name()
+	}
+}
+
+// isExtracted reports whether pkg is the package being extracted.
+func (e *extractor) isExtracted(pkg *types.Package) bool {
+	if e.pkgPath != "" {
+		return pkg.Path() == e.pkgPath
+	}
+	return pkg.Path() == e.pkgName
+}
+
+// fieldWrites records the fields written by the assignment of lhs, with the given
+// operation, so that their access is extracted as a write once they are visited.
+func (e *extractor) fieldWrites(lhs []ast.Expr, op string) {
+	for _, l := range lhs {
+		for {
+			paren, ok := l.(*ast.ParenExpr)
+			if !ok {
+				break
+			}
+			l = paren.X
+		}
+
+		switch x := l.(type) {
+		case *ast.SelectorExpr:
+			e.writes[x] = op
+		case *ast.IndexExpr:
+			if sel, ok := x.X.(*ast.SelectorExpr); ok {
+				e.writes[sel] = "index"
+			}
+		}
+	}
+}
+
+// addressTaken records the field whose address is taken by x, either explicitly as in
+// &s.count, or implicitly by calling a method with a pointer receiver as in s.mu.Lock().
+func (e *extractor) addressTaken(x ast.Expr) {
+	switch x := x.(type) {
+	case *ast.UnaryExpr:
+		if x.Op == token.AND {
+			e.written([]ast.Expr{x.X}, "addr")
+		}
+	case *ast.SelectorExpr:
+		selection, ok := e.info.Selections[x]
+		if !ok || selection.Kind() != types.MethodVal {
+			return
+		}
+		sig, ok := selection.Obj().Type().(*types.Signature)
+		if !ok || sig.Recv() == nil {
+			return
+		}
+		if _, isPtr := sig.Recv().Type().(*types.Pointer); !isPtr {
+			return
+		}
+		if tv, ok := e.info.Types[x.X]; ok {
+			if _, isPtr := tv.Type.Underlying().(*types.Pointer); isPtr {
+				return
+			}
+		}
+		e.written([]ast.Expr{x.X}, "addr")
+	}
+}
+
+// fieldAccess adds the ReadsField or WritesField edge of the field selected by sel.
+func (e *extractor) fieldAccess(sel *ast.SelectorExpr) {
+	e.addressTaken(sel)
+
+	field := e.selectedField(sel)
+	if field == nil {
+		return
+	}
+
+	edge := e.graph.AddEdge(e.currentFunc, field, ReadsField)
+	if op, written := e.writes[sel]; written {
+		edge.Relation = WritesField
+		edge.SetAttr("op", op)
+	}
+	edge.SetAttr("pos", e.fset.Position(sel.Sel.Pos()).String())
+}
+
+// fieldInits adds a WritesField edge for every field initialized by a keyed composite
+// literal.
+func (e *extractor) fieldInits(lit *ast.CompositeLit) {
+	tv, ok := e.info.Types[lit]
+	if !ok {
+		return
+	}
+	t := tv.Type
+	if ptr, ok := t.Underlying().(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	owner, ok := t.(*types.Named)
+	if !ok {
+		return
+	}
+	if _, ok := owner.Underlying().(*types.Struct); !ok {
+		return
+	}
+
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		key, ok := kv.Key.(*ast.Ident)
+		if !ok {
+			continue
+		}
+		v, ok := e.info.Uses[key].(*types.Var)
+		if !ok || !v.IsField() {
+			continue
+		}
+		edge := e.graph.AddEdge(e.currentFunc, e.fieldNode(v, e.objectName(owner.Origin().Obj())), WritesField)
+		edge.SetAttr("pos", e.fset.Position(key.Pos()).String())
+		edge.SetAttr("op", "init")
+	}
+}
+
+// FieldWriters returns the functions writing the field with the given name, e.g.
+// "Server.count", sorted by name.
+func FieldWriters(graph *Graph, field string) []*Node {
+	return fieldAccessors(graph, field, WritesField)
+}
+
+// FieldReaders returns the functions reading the field with the given name, sorted by name.
+func FieldReaders(graph *Graph, field string) []*Node {
+	return fieldAccessors(graph, field, ReadsField)
+}
+
+func fieldAccessors(graph *Graph, field string, r Relation) []*Node {
+	seen := make(map[*Node]bool)
+	var nodes []*Node
+	for _, edge := range graph.Edges {
+		if edge.Relation == r && edge.To.Type == Field && edge.To.Name == field && !seen[edge.From] {
+			seen[edge.From] = true
+			nodes = append(nodes, edge.From)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+	return nodes
+}
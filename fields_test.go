@@ -0,0 +1,115 @@
+package astro
+
+import (
+	"testing"
+)
+
+func TestExtractGraphFromAST_Fields(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+
+import "sync"
+
+type base struct {
+	id int
+}
+
+type Server struct {
+	base
+	mu    sync.Mutex
+	count int
+	items map[string]int
+	Name  string
+}
+
+func NewServer() *Server {
+	return &Server{Name: "srv", items: map[string]int{}}
+}
+
+func (s *Server) Add(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[key] = s.count
+	s.count++
+}
+
+func (s *Server) Count() int {
+	return s.count
+}
+
+func reset(s *Server) {
+	s.count = 0
+	s.id += 1
+	p := &s.Name
+	_ = p
+}
+`
+
+	graph, err := ExtractGraphFromAST(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	if countNodeType(graph, Field) != 6 {
+		t.Errorf("Expected 6 fields, got %d", countNodeType(graph, Field))
+	}
+
+	got := relationEdges(graph, ReadsField, WritesField)
+	expected := []string{
+		"(NewServer)-[:WritesField]->(Server.Name)",
+		"(NewServer)-[:WritesField]->(Server.items)",
+		"(Server.Add)-[:ReadsField]->(Server.count)",
+		"(Server.Add)-[:WritesField]->(Server.count)",
+		"(Server.Add)-[:WritesField]->(Server.items)",
+		"(Server.Add)-[:WritesField]->(Server.mu)",
+		"(Server.Add)-[:WritesField]->(Server.mu)",
+		"(Server.Count)-[:ReadsField]->(Server.count)",
+		"(reset)-[:WritesField]->(Server.Name)",
+		"(reset)-[:WritesField]->(Server.count)",
+		"(reset)-[:WritesField]->(base.id)",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected edges %v, got %v", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("Expected edge %s, got %s", expected[i], got[i])
+		}
+	}
+
+	ops := make(map[string]string)
+	for _, edge := range graph.Edges {
+		if edge.Relation == WritesField {
+			ops[edge.Attr("pos")] = edge.Attr("op")
+		}
+	}
+	expectedOps := map[string]string{
+		"19:17": "init",
+		"23:4":  "addr",
+		"25:4":  "index",
+		"26:4":  "inc",
+		"34:4":  "assign",
+		"35:4":  "assign",
+		"36:10": "addr",
+	}
+	for pos, op := range expectedOps {
+		if ops[pos] != op {
+			t.Errorf("Expected a %s write at %s, got %q", op, pos, ops[pos])
+		}
+	}
+
+	writers := FieldWriters(graph, "Server.count")
+	if len(writers) != 2 || writers[0].Name != "Server.Add" || writers[1].Name != "reset" {
+		t.Errorf("Expected Server.count to be written by Server.Add and reset, got %v", writers)
+	}
+	readers := FieldReaders(graph, "Server.count")
+	if len(readers) != 2 || readers[0].Name != "Server.Add" || readers[1].Name != "Server.Count" {
+		t.Errorf("Expected Server.count to be read by Server.Add and Server.Count, got %v", readers)
+	}
+
+	if count := findNode(graph, Field, "Server.count"); count == nil || count.Attr("type") != "int" || count.Attr("pos") != "13:2" {
+		t.Errorf("Expected Server.count to be declared as an int at 13:2, got %v", count)
+	}
+}
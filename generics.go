@@ -0,0 +1,146 @@
+package astro
+
+import (
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// declareTypeParams declares the type parameters of the generic function or type owner,
+// each with a Constraint edge to its constraint.
+func (e *extractor) declareTypeParams(owner *Node, params *ast.FieldList) {
+	if params == nil {
+		return
+	}
+
+	owner.SetAttr("generic", "true")
+	for _, field := range params.List {
+		constraint := e.constraintNode(field.Type)
+		for _, name := range field.Names {
+			param := e.objectNode(name, TypeParam)
+			param.SetAttr("pos", e.fset.Position(name.Pos()).String())
+			param.SetAttr("scope", owner.Name)
+			e.graph.AddEdge(owner, param, Declares)
+			e.graph.AddEdge(param, constraint, Constraint)
+		}
+	}
+}
+
+// constraintNode returns the node of the constraint expr: the node of the type declaring
+// it in the file, or else a Type node named after the expression, e.g. "comparable" or
+// "~int | ~float64", marked with a "constraint" kind.
+func (e *extractor) constraintNode(expr ast.Expr) *Node {
+	if ident, ok := expr.(*ast.Ident); ok && ident.Obj != nil {
+		if node, exists := e.objects[ident.Obj]; exists {
+			return node
+		}
+	}
+
+	name := types.ExprString(expr)
+	if node, exists := e.constraints[name]; exists {
+		return node
+	}
+
+	node := NewNode(TypeDecl, name)
+	node.SetAttr("kind", "constraint")
+	e.graph.Nodes = append(e.graph.Nodes, node)
+	e.constraints[name] = node
+
+	return node
+}
+
+// instance returns the instantiation of the generic function called through fun, with
+// explicit or inferred type arguments.
+func (e *extractor) instance(fun ast.Expr) (types.Instance, bool) {
+	for {
+		switch x := fun.(type) {
+		case *ast.ParenExpr:
+			fun = x.X
+		case *ast.IndexExpr:
+			fun = x.X
+		case *ast.IndexListExpr:
+			fun = x.X
+		case *ast.Ident:
+			inst, ok := e.info.Instances[x]
+			return inst, ok
+		case *ast.SelectorExpr:
+			inst, ok := e.info.Instances[x.Sel]
+			return inst, ok
+		default:
+			return types.Instance{}, false
+		}
+	}
+}
+
+// instanceNode returns the node of an instantiation of generic, named after its type
+// arguments, e.g. "Map[int, string]". The instance is linked to the generic function by
+// an Instantiates edge.
+func (e *extractor) instanceNode(generic *Node, inst types.Instance) *Node {
+	args := typeArgs(inst)
+	name := generic.Name + "[" + args + "]"
+	if node, exists := e.graph.NodeMap[name]; exists {
+		return node
+	}
+
+	node := e.funcNode(name)
+	node.SetAttr("generic", generic.Name)
+	node.SetAttr("types", args)
+	if pkg := generic.Attr("pkg"); pkg != "" {
+		node.SetAttr("pkg", pkg)
+	}
+	edge := e.graph.AddEdge(node, generic, Instantiates)
+	edge.SetAttr("types", args)
+
+	return node
+}
+
+// typeArgs formats the type arguments of inst, e.g. "int, string".
+func typeArgs(inst types.Instance) string {
+	args := make([]string, inst.TypeArgs.Len())
+	for i := range args {
+		args[i] = typeString(inst.TypeArgs.At(i))
+	}
+	return strings.Join(args, ", ")
+}
+
+// Instantiation is a use of a generic function with given type arguments.
+type Instantiation struct {
+	Generic *Node  // generic function
+	Types   string // type arguments, e.g. "int, string"
+	Sites   []*Edge
+}
+
+// Instantiations returns the distinct instantiations of the generic functions of graph,
+// ordered by generic function then type arguments, with the Instantiates edges of their
+// call sites. Graphs extracted with a node per instantiation have one site per instance.
+func Instantiations(graph *Graph) []*Instantiation {
+	type key struct {
+		generic *Node
+		types   string
+	}
+
+	var result []*Instantiation
+	byKey := make(map[key]*Instantiation)
+	for _, edge := range graph.Edges {
+		if edge.Relation != Instantiates {
+			continue
+		}
+		k := key{edge.To, edge.Attr("types")}
+		inst, exists := byKey[k]
+		if !exists {
+			inst = &Instantiation{Generic: edge.To, Types: k.types}
+			byKey[k] = inst
+			result = append(result, inst)
+		}
+		inst.Sites = append(inst.Sites, edge)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Generic.Name != result[j].Generic.Name {
+			return result[i].Generic.Name < result[j].Generic.Name
+		}
+		return result[i].Types < result[j].Types
+	})
+	return result
+}
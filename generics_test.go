@@ -0,0 +1,134 @@
+package astro
+
+import (
+	"testing"
+)
+
+const genericsSrc = `
+package main
+
+type Number interface {
+	~int | ~float64
+}
+
+type Stack[T any] struct {
+	items []T
+}
+
+func Map[T, U any](xs []T, f func(T) U) []U {
+	return nil
+}
+
+func Sum[N Number](xs []N) N {
+	var total N
+	return total
+}
+
+func Keys[K comparable, V any](m map[K]V) []K {
+	return nil
+}
+
+func itoa(i int) string {
+	return ""
+}
+
+func main() {
+	Map([]int{1}, itoa)
+	Map[int, string]([]int{2}, itoa)
+	Sum([]float64{1.5})
+	Keys(map[string]bool{})
+	_ = Stack[int]{}
+}
+`
+
+func TestExtractGraphFromAST_Generics(t *testing.T) {
+	t.Parallel()
+
+	graph, err := ExtractGraphFromAST(genericsSrc)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	if countNodeType(graph, TypeParam) != 6 {
+		t.Errorf("Expected 6 type parameters, got %d", countNodeType(graph, TypeParam))
+	}
+
+	got := relationEdges(graph, Constraint)
+	expected := []string{
+		"(K)-[:Constraint]->(comparable)",
+		"(N)-[:Constraint]->(Number)",
+		"(T)-[:Constraint]->(any)",
+		"(T)-[:Constraint]->(any)",
+		"(U)-[:Constraint]->(any)",
+		"(V)-[:Constraint]->(any)",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected edges %v, got %v", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("Expected edge %s, got %s", expected[i], got[i])
+		}
+	}
+
+	// a constraint declared in the file is its type node
+	if number := findNode(graph, TypeDecl, "Number"); number == nil || number.Attr("kind") == "constraint" {
+		t.Errorf("Expected Number to be the declared type, got %v", number)
+	}
+	if stack := findNode(graph, TypeDecl, "Stack"); stack == nil || stack.Attr("generic") != "true" {
+		t.Errorf("Expected Stack to be generic, got %v", stack)
+	}
+
+	instantiations := Instantiations(graph)
+	expectedTypes := map[string][]string{
+		"Keys": {"string, bool"},
+		"Map":  {"int, string"},
+		"Sum":  {"float64"},
+	}
+	if len(instantiations) != 3 {
+		t.Fatalf("Expected 3 instantiations, got %v", instantiations)
+	}
+	for _, inst := range instantiations {
+		types := expectedTypes[inst.Generic.Name]
+		if len(types) != 1 || types[0] != inst.Types {
+			t.Errorf("Expected %s to be instantiated with %v, got %s", inst.Generic.Name, types, inst.Types)
+		}
+	}
+	if sites := instantiations[1].Sites; len(sites) != 2 || sites[0].From.Name != "main" {
+		t.Errorf("Expected Map to be instantiated twice by main, got %v", sites)
+	}
+}
+
+func TestExtractGraphFromAST_Instances(t *testing.T) {
+	t.Parallel()
+
+	graph, err := NewBuilder(WithInstances(true)).Extract(genericsSrc)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	got := relationEdges(graph, Instantiates)
+	expected := []string{
+		"(Keys[string, bool])-[:Instantiates]->(Keys)",
+		"(Map[int, string])-[:Instantiates]->(Map)",
+		"(Sum[float64])-[:Instantiates]->(Sum)",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected edges %v, got %v", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("Expected edge %s, got %s", expected[i], got[i])
+		}
+	}
+
+	calls := 0
+	for _, edge := range graph.Edges {
+		if edge.Relation == Call && edge.To.Name == "Map[int, string]" {
+			calls++
+		}
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 calls of Map[int, string], got %d", calls)
+	}
+}
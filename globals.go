@@ -0,0 +1,294 @@
+package astro
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// written records the fields and package-level variables written by the assignment of
+// lhs with the given operation.
+func (e *extractor) written(lhs []ast.Expr, op string) {
+	e.fieldWrites(lhs, op)
+	e.globalWrites(lhs, op)
+}
+
+// globalWrites adds a Writes edge from the current function to every package-level
+// variable written by the assignment of lhs. Writes through a variable, as in
+// cfg.Timeout = t or cache[k] = v, are writes to the variable, recording the expression
+// written in the "expr" attribute.
+func (e *extractor) globalWrites(lhs []ast.Expr, op string) {
+	for _, l := range lhs {
+		ident := e.writtenVar(l)
+		if ident == nil {
+			continue
+		}
+		global := e.globalNode(ident)
+		if global == nil {
+			continue
+		}
+
+		edge := e.graph.AddEdge(e.currentFunc, global, Writes)
+		edge.SetAttr("pos", e.fset.Position(ident.Pos()).String())
+		edge.SetAttr("op", op)
+		if l != ast.Expr(ident) {
+			edge.SetAttr("expr", types.ExprString(l))
+		}
+	}
+}
+
+// writtenVar returns the identifier of the variable written by an assignment to expr, so
+// that s.field = v, s[i] = v and *p = v are treated as writes to s and p, resolving the
+// members of imported packages, as in pkg.Var = v.
+func (e *extractor) writtenVar(expr ast.Expr) *ast.Ident {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		return x
+	case *ast.SelectorExpr:
+		if pkg, ok := x.X.(*ast.Ident); ok && pkg.Obj == nil {
+			if _, imported := e.imports[pkg.Name]; imported {
+				return x.Sel
+			}
+		}
+		return e.writtenVar(x.X)
+	case *ast.IndexExpr:
+		return e.writtenVar(x.X)
+	case *ast.StarExpr:
+		return e.writtenVar(x.X)
+	case *ast.ParenExpr:
+		return e.writtenVar(x.X)
+	}
+	return nil
+}
+
+// globalNode returns the node of the package-level variable ident refers to, or nil if
+// it refers to anything else.
+//
+// Variables of the same file are resolved by the parser. Variables of other files and
+// packages of the extraction are resolved with type information, and may be used before
+// the package declaring them is extracted: their node is then created on their first
+// use, and adopted by their declaration.
+func (e *extractor) globalNode(ident *ast.Ident) *Node {
+	if ident.Obj != nil {
+		if node, exists := e.objects[ident.Obj]; exists && node.Attr("kind") == "global" {
+			return node
+		}
+		return nil
+	}
+
+	v, ok := e.info.Uses[ident].(*types.Var)
+	if !ok || !isGlobal(v) {
+		return nil
+	}
+	if _, extracted := e.tree[v.Pkg().Path()]; !extracted {
+		return nil
+	}
+
+	node, exists := e.globals[v]
+	if !exists {
+		node = NewNode(Var, v.Name())
+		node.SetAttr("kind", "global")
+		e.graph.Nodes = append(e.graph.Nodes, node)
+		e.globals[v] = node
+	}
+	return node
+}
+
+// isGlobal reports whether v is a package-level variable.
+func isGlobal(v *types.Var) bool {
+	return !v.IsField() && v.Pkg() != nil && v.Parent() == v.Pkg().Scope()
+}
+
+// GlobalVar is the use of a package-level variable throughout the graph.
+type GlobalVar struct {
+	Var     *Node
+	Writers []*Node // functions writing the variable, sorted by name
+	Readers []*Node // functions reading the variable, sorted by name
+
+	// OutsideInit holds the writers which may run once the package is initialized:
+	// every writer but the init functions and the functions only called while
+	// initializing the package.
+	OutsideInit []*Node
+}
+
+// Mutable reports whether the variable may be written once the package is initialized.
+func (g *GlobalVar) Mutable() bool {
+	return len(g.OutsideInit) > 0
+}
+
+func (g *GlobalVar) String() string {
+	var b strings.Builder
+	b.WriteString(g.Var.Name)
+	if g.Mutable() {
+		fmt.Fprintf(&b, " is mutable: written by %s", nodeNames(g.OutsideInit))
+	} else if len(g.Writers) > 0 {
+		fmt.Fprintf(&b, " is written during initialization by %s", nodeNames(g.Writers))
+	} else {
+		b.WriteString(" is never written")
+	}
+	if len(g.Readers) > 0 {
+		fmt.Fprintf(&b, "; read by %s", nodeNames(g.Readers))
+	}
+	return b.String()
+}
+
+func nodeNames(nodes []*Node) string {
+	names := make([]string, len(nodes))
+	for i, node := range nodes {
+		names[i] = node.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// GlobalState reports every package-level variable of graph, in the order the variables
+// appear in the graph, with the functions writing and reading it.
+//
+// A function writes a variable by assigning it or one of its elements or fields,
+// incrementing it, taking its address, or calling a method with a pointer receiver on
+// it. Reading a variable is any other use. Whether a writer may run outside init is
+// decided conservatively over the call graph: a function only called by functions only
+// run at initialization is itself only run at initialization, which misses the functions
+// that are only called through a function value.
+func GlobalState(graph *Graph) []*GlobalVar {
+	initOnly := initFunctions(graph)
+
+	globals := make(map[*Node]*GlobalVar)
+	var result []*GlobalVar
+	for _, node := range graph.Nodes {
+		if isVariable(node) && node.Attr("kind") == "global" && globals[node] == nil {
+			globals[node] = &GlobalVar{Var: node}
+			result = append(result, globals[node])
+		}
+	}
+
+	// uses at the position of a write are part of the write
+	writes := make(map[string]bool)
+	for _, edge := range graph.Edges {
+		if edge.Relation == Writes {
+			writes[edge.From.Name+"@"+edge.Attr("pos")] = true
+		}
+	}
+
+	writers := make(map[*Node]map[*Node]bool)
+	readers := make(map[*Node]map[*Node]bool)
+	for _, edge := range graph.Edges {
+		global, ok := globals[edge.To]
+		if !ok {
+			continue
+		}
+
+		switch {
+		case edge.Relation == Writes:
+			if writers[edge.To] == nil {
+				writers[edge.To] = make(map[*Node]bool)
+			}
+			if !writers[edge.To][edge.From] {
+				writers[edge.To][edge.From] = true
+				global.Writers = append(global.Writers, edge.From)
+				if !initOnly[edge.From] {
+					global.OutsideInit = append(global.OutsideInit, edge.From)
+				}
+			}
+		case edge.Relation == Uses && !writes[edge.From.Name+"@"+edge.Attr("pos")]:
+			if readers[edge.To] == nil {
+				readers[edge.To] = make(map[*Node]bool)
+			}
+			if !readers[edge.To][edge.From] {
+				readers[edge.To][edge.From] = true
+				global.Readers = append(global.Readers, edge.From)
+			}
+		}
+	}
+
+	for _, global := range result {
+		for _, nodes := range [][]*Node{global.Writers, global.Readers, global.OutsideInit} {
+			sort.Slice(nodes, func(i, j int) bool {
+				return nodes[i].Name < nodes[j].Name
+			})
+		}
+	}
+
+	return result
+}
+
+// initFunctions returns the functions only run while initializing their package: the
+// init functions, and the functions and function literals whose callers all are. Exported
+// functions and methods never are, since importers outside the graph may call them.
+func initFunctions(graph *Graph) map[*Node]bool {
+	callers := make(map[*Node][]*Node)
+	for _, edge := range graph.Edges {
+		switch edge.Relation {
+		case Call, Spawns, Defers, Panics, Defines:
+			callers[edge.To] = append(callers[edge.To], edge.From)
+		}
+	}
+
+	initOnly := make(map[*Node]bool)
+	for _, node := range graph.Nodes {
+		if node.Type == Func && (node.Name == "init" || strings.HasSuffix(node.Name, ".init")) {
+			initOnly[node] = true
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for node, from := range callers {
+			if initOnly[node] || (node.Type != Func && node.Type != FuncLit) {
+				continue
+			}
+			if node.Type == Func && ast.IsExported(baseName(node.Name)) {
+				continue
+			}
+			all := true
+			for _, caller := range from {
+				all = all && initOnly[caller]
+			}
+			if all {
+				initOnly[node] = true
+				changed = true
+			}
+		}
+	}
+
+	return initOnly
+}
+
+// GlobalStateGraph derives a graph of the package-level variables of graph and the
+// functions accessing them, with a Writes edge from every writer and a Uses edge from
+// every reader. Writes edges of writers only run at initialization are marked with an
+// "init" attribute. The graph can be printed by the query builders:
+//
+//	NewQuery(&ConcreteQueryBuilder{Graph: GlobalStateGraph(graph)})
+func GlobalStateGraph(graph *Graph) *Graph {
+	gs := NewGraph()
+	added := make(map[*Node]bool)
+	add := func(n *Node) {
+		if !added[n] {
+			added[n] = true
+			gs.Nodes = append(gs.Nodes, n)
+		}
+	}
+
+	for _, global := range GlobalState(graph) {
+		add(global.Var)
+		mutable := make(map[*Node]bool)
+		for _, writer := range global.OutsideInit {
+			mutable[writer] = true
+		}
+		for _, writer := range global.Writers {
+			add(writer)
+			edge := gs.AddEdge(writer, global.Var, Writes)
+			if !mutable[writer] {
+				edge.SetAttr("init", "true")
+			}
+		}
+		for _, reader := range global.Readers {
+			add(reader)
+			gs.AddEdge(reader, global.Var, Uses)
+		}
+	}
+
+	return gs
+}
@@ -0,0 +1,146 @@
+package astro
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGlobalState(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+
+import "sync"
+
+type config struct {
+	verbose bool
+}
+
+var (
+	mu      sync.Mutex
+	counter int
+	cache   = map[string]int{}
+	cfg     config
+	version = "1.0"
+	limit   int
+)
+
+func init() {
+	loadConfig()
+	Reset()
+}
+
+func loadConfig() {
+	cfg.verbose = true
+}
+
+func Reset() {
+	limit = 10
+}
+
+func inc(key string) {
+	mu.Lock()
+	defer mu.Unlock()
+	counter++
+	cache[key] = counter
+}
+
+func main() {
+	inc("a")
+	println(version, cfg.verbose)
+}
+`
+
+	graph, err := ExtractGraphFromAST(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	report := GlobalState(graph)
+	expected := []string{
+		"mu is mutable: written by inc",
+		"counter is mutable: written by inc; read by inc",
+		"cache is mutable: written by inc",
+		"cfg is written during initialization by loadConfig; read by main",
+		"version is never written; read by main",
+		"limit is mutable: written by Reset",
+	}
+	if len(report) != len(expected) {
+		t.Fatalf("Expected %d variables, got %v", len(expected), report)
+	}
+	for i, global := range report {
+		if global.String() != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], global)
+		}
+	}
+
+	ops := make(map[string]string)
+	for _, edge := range graph.Edges {
+		if edge.Relation == Writes {
+			ops[edge.To.Name] = edge.Attr("op")
+		}
+	}
+	expectedOps := map[string]string{"mu": "addr", "counter": "inc", "cache": "assign", "cfg": "assign"}
+	for name, op := range expectedOps {
+		if ops[name] != op {
+			t.Errorf("Expected %s to be written by %s, got %q", name, op, ops[name])
+		}
+	}
+
+	query := NewQuery(&ConcreteQueryBuilder{Graph: GlobalStateGraph(graph)}).Builder.BuildQuery()
+	if !strings.Contains(query, "(inc)-[:Writes]->(counter)") || !strings.Contains(query, "(main)-[:Uses]->(version)") {
+		t.Errorf("Expected the query to list writers and readers, got %s", query)
+	}
+}
+
+func TestGlobalState_Packages(t *testing.T) {
+	t.Parallel()
+
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.21\n",
+		"main.go": `package main
+
+import "example.com/app/settings"
+
+func main() {
+	settings.Debug = true
+	println(settings.Name)
+}
+`,
+		"settings/settings.go": `package settings
+
+var Debug bool
+`,
+		"settings/name.go": `package settings
+
+var Name = "app"
+
+func init() {
+	Debug = false
+}
+`,
+	})
+
+	graph, err := ExtractGraphFromDir(root)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	report := make(map[string]*GlobalVar)
+	for _, global := range GlobalState(graph) {
+		report[global.Var.Name] = global
+	}
+	if len(report) != 2 {
+		t.Fatalf("Expected 2 variables, got %v", report)
+	}
+
+	// variables are resolved across files and packages, regardless of the order
+	debug := report["Debug"]
+	if debug == nil || len(debug.Writers) != 2 || len(debug.OutsideInit) != 1 || debug.OutsideInit[0].Name != "example.com/app.main" {
+		t.Errorf("Expected Debug to be written by init and main, got %v", debug)
+	}
+	if name := report["Name"]; name == nil || name.Mutable() || len(name.Readers) != 1 {
+		t.Errorf("Expected Name to be read by main only, got %v", name)
+	}
+}
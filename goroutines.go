@@ -0,0 +1,322 @@
+package astro
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GoroutineLeak is a goroutine that may block forever on channel operations nobody
+// else performs the counterpart of.
+type GoroutineLeak struct {
+	Spawn     *Edge   // Spawns edge starting the goroutine
+	Goroutine *Node   // function run by the goroutine
+	Ops       []*Edge // Sends and Receives edges without a counterpart
+}
+
+func (l *GoroutineLeak) String() string {
+	ops := make([]string, len(l.Ops))
+	for i, op := range l.Ops {
+		verb := "sends on"
+		if op.Relation == Receives {
+			verb = "receives from"
+		}
+		ops[i] = fmt.Sprintf("%s %s at %s", verb, op.To.Name, op.Attr("pos"))
+	}
+	return fmt.Sprintf("%s spawned at %s may leak: %s", l.Goroutine.Name, l.Spawn.Attr("pos"), strings.Join(ops, ", "))
+}
+
+// GoroutineLeaks reports the goroutines whose channel operations have no counterpart.
+//
+// The channel operations of a goroutine are the Sends and Receives edges of the spawned
+// function and of the functions it calls. A send is matched by a receive on the same
+// channel, and a receive by a send or a close, performed by the spawning function or any
+// function reachable from it through Call, Defers and Spawns edges, outside of the goroutine.
+// Channels passed or assigned to other variables are the same channel, so a channel
+// created by the spawning function matches the channel parameter of the goroutine.
+//
+// Operations of a select statement only block when none of its cases can proceed, so
+// they are reported only if none of them has a counterpart.
+func GoroutineLeaks(graph *Graph) []*GoroutineLeak {
+	channel := channelAliases(graph)
+
+	ops := make(map[*Node][]*Edge) // channel operations by function
+	closed := make(map[*Node]bool) // channels passed to close
+	for _, edge := range graph.Edges {
+		switch {
+		case edge.Relation == Sends || edge.Relation == Receives:
+			ops[edge.From] = append(ops[edge.From], edge)
+		case edge.Relation == PassesTo && edge.From.Type == Channel && edge.To.Type == Func && edge.To.Name == "close":
+			closed[channel(edge.From)] = true
+		}
+	}
+
+	calls := func(e *Edge) bool {
+		return e.Relation == Call || e.Relation == Defers
+	}
+	callsOrSpawns := func(e *Edge) bool {
+		return calls(e) || e.Relation == Spawns
+	}
+
+	var leaks []*GoroutineLeak
+	for _, spawn := range graph.Edges {
+		if spawn.Relation != Spawns {
+			continue
+		}
+
+		goroutine := reachable(graph, spawn.To, calls)
+		var own []*Edge
+		for _, fn := range goroutine.order {
+			own = append(own, ops[fn]...)
+		}
+		if len(own) == 0 {
+			continue
+		}
+
+		// operations the rest of the program may perform concurrently
+		sends := make(map[*Node]bool)
+		receives := make(map[*Node]bool)
+		for _, fn := range reachable(graph, spawn.From, callsOrSpawns).order {
+			if goroutine.nodes[fn] {
+				continue
+			}
+			for _, op := range ops[fn] {
+				if op.Relation == Sends {
+					sends[channel(op.To)] = true
+				} else {
+					receives[channel(op.To)] = true
+				}
+			}
+		}
+
+		var unmatched, unmatchedSelect []*Edge
+		selectMatched := false
+		for _, op := range own {
+			ch := channel(op.To)
+			matched := receives[ch]
+			if op.Relation == Receives {
+				matched = sends[ch] || closed[ch]
+			}
+
+			switch {
+			case op.Attr("select") != "":
+				selectMatched = selectMatched || matched
+				if !matched {
+					unmatchedSelect = append(unmatchedSelect, op)
+				}
+			case !matched:
+				unmatched = append(unmatched, op)
+			}
+		}
+		if !selectMatched {
+			unmatched = append(unmatched, unmatchedSelect...)
+		}
+
+		if len(unmatched) > 0 {
+			leaks = append(leaks, &GoroutineLeak{Spawn: spawn, Goroutine: spawn.To, Ops: unmatched})
+		}
+	}
+
+	return leaks
+}
+
+// channelAliases groups the channel nodes connected by data-flow edges, and returns a
+// function mapping a channel to the representative of its group.
+func channelAliases(graph *Graph) func(*Node) *Node {
+	parent := make(map[*Node]*Node)
+	var find func(n *Node) *Node
+	find = func(n *Node) *Node {
+		p, ok := parent[n]
+		if !ok || p == n {
+			return n
+		}
+		root := find(p)
+		parent[n] = root
+		return root
+	}
+
+	for _, edge := range graph.Edges {
+		if isDataFlow(edge.Relation) && edge.From.Type == Channel && edge.To.Type == Channel {
+			from, to := find(edge.From), find(edge.To)
+			if from != to {
+				parent[from] = to
+			}
+		}
+	}
+
+	return find
+}
+
+// reachableSet holds the nodes reachable from a node, in the order they were found.
+type reachableSet struct {
+	nodes map[*Node]bool
+	order []*Node
+}
+
+// reachable returns the nodes reachable from start, including start, over the edges
+// accepted by follow.
+func reachable(graph *Graph, start *Node, follow func(e *Edge) bool) reachableSet {
+	adjacency := make(map[*Node][]*Node)
+	for _, edge := range graph.Edges {
+		if follow(edge) {
+			adjacency[edge.From] = append(adjacency[edge.From], edge.To)
+		}
+	}
+
+	set := reachableSet{nodes: map[*Node]bool{start: true}, order: []*Node{start}}
+	for i := 0; i < len(set.order); i++ {
+		for _, next := range adjacency[set.order[i]] {
+			if !set.nodes[next] {
+				set.nodes[next] = true
+				set.order = append(set.order, next)
+			}
+		}
+	}
+
+	return set
+}
+
+// LockOrderGraph derives the lock-order graph of graph: a graph of the Mutex nodes of
+// graph, with a Locks edge from a mutex to every mutex acquired while holding it.
+//
+// Lock acquisitions are ordered by their position within a function, regardless of its
+// control flow. A mutex is held from its Locks edge until its Unlocks edge, or until the
+// end of the function if the unlock is deferred. Calls made while holding a mutex order
+// it before every mutex the callee acquires, directly or through its own calls. Each edge
+// records the function acquiring the second mutex in the "func" attribute, and where it
+// does so in the "pos" attribute.
+func LockOrderGraph(graph *Graph) *Graph {
+	lg := NewGraph()
+	mutexes := make(map[*Node]*Node)
+	for _, node := range graph.Nodes {
+		if node.Type == Mutex {
+			mutex := NewNode(Mutex, node.Name)
+			for k, v := range node.Attrs {
+				mutex.SetAttr(k, v)
+			}
+			lg.Nodes = append(lg.Nodes, mutex)
+			mutexes[node] = mutex
+		}
+	}
+
+	// lock, unlock and call events of every function, in source order
+	events := make(map[*Node][]*Edge)
+	var funcs []*Node
+	for _, edge := range graph.Edges {
+		switch edge.Relation {
+		case Locks, Unlocks, Call:
+			if edge.Attr("pos") == "" {
+				continue
+			}
+			if _, ok := events[edge.From]; !ok {
+				funcs = append(funcs, edge.From)
+			}
+			events[edge.From] = append(events[edge.From], edge)
+		}
+	}
+
+	// mutexes acquired by a function and the functions it calls
+	calls := func(e *Edge) bool {
+		return e.Relation == Call || e.Relation == Defers
+	}
+	acquires := make(map[*Node][]*Node)
+	acquired := func(fn *Node) []*Node {
+		if locks, ok := acquires[fn]; ok {
+			return locks
+		}
+		seen := make(map[*Node]bool)
+		var locks []*Node
+		for _, callee := range reachable(graph, fn, calls).order {
+			for _, edge := range events[callee] {
+				if edge.Relation == Locks && !seen[edge.To] {
+					seen[edge.To] = true
+					locks = append(locks, edge.To)
+				}
+			}
+		}
+		acquires[fn] = locks
+		return locks
+	}
+
+	type key struct{ from, to *Node }
+	added := make(map[key]bool)
+	order := func(held, mutex *Node, fn *Node, pos string) {
+		k := key{held, mutex}
+		if held == mutex || added[k] {
+			return
+		}
+		added[k] = true
+		edge := lg.AddEdge(mutexes[held], mutexes[mutex], Locks)
+		edge.SetAttr("func", fn.Name)
+		edge.SetAttr("pos", pos)
+	}
+
+	for _, fn := range funcs {
+		fnEvents := events[fn]
+		sort.SliceStable(fnEvents, func(i, j int) bool {
+			return comparePos(fnEvents[i].Attr("pos"), fnEvents[j].Attr("pos")) < 0
+		})
+
+		var held []*Node
+		for _, edge := range fnEvents {
+			switch edge.Relation {
+			case Locks:
+				for _, h := range held {
+					order(h, edge.To, fn, edge.Attr("pos"))
+				}
+				held = append(held, edge.To)
+			case Unlocks:
+				if edge.Attr("deferred") != "" {
+					continue
+				}
+				for i := len(held) - 1; i >= 0; i-- {
+					if held[i] == edge.To {
+						held = append(held[:i], held[i+1:]...)
+						break
+					}
+				}
+			case Call:
+				if len(held) == 0 {
+					continue
+				}
+				for _, mutex := range acquired(edge.To) {
+					for _, h := range held {
+						order(h, mutex, fn, edge.Attr("pos"))
+					}
+				}
+			}
+		}
+	}
+
+	return lg
+}
+
+// LockOrderCycles returns the cycles of a lock-order graph, as paths starting and ending
+// at the same mutex. Each cycle is a potential deadlock: the functions along it acquire
+// the same mutexes in inconsistent orders.
+func LockOrderCycles(lg *Graph) [][]*Node {
+	return cycles(lg, func(e *Edge) bool {
+		return e.Relation == Locks
+	})
+}
+
+// comparePos compares two positions formatted as "[file:]line:column" by line and column.
+func comparePos(a, b string) int {
+	al, ac := splitPos(a)
+	bl, bc := splitPos(b)
+	if al != bl {
+		return al - bl
+	}
+	return ac - bc
+}
+
+func splitPos(pos string) (int, int) {
+	parts := strings.Split(pos, ":")
+	if len(parts) < 2 {
+		return 0, 0
+	}
+	line, _ := strconv.Atoi(parts[len(parts)-2])
+	column, _ := strconv.Atoi(parts[len(parts)-1])
+	return line, column
+}
@@ -0,0 +1,219 @@
+package astro
+
+import (
+	"testing"
+)
+
+func TestGoroutineLeaks(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+
+func main() {
+	jobs := make(chan int)
+	results := make(chan int)
+	quit := make(chan bool)
+	go produce(jobs)
+	go consume(jobs, results)
+	go func() {
+		select {
+		case <-quit:
+		case results <- 0:
+		}
+	}()
+	<-results
+}
+
+func produce(jobs chan<- int) {
+	jobs <- 1
+	close(jobs)
+}
+
+func consume(jobs <-chan int, results chan<- int) {
+	for job := range jobs {
+		results <- job
+	}
+}
+
+func orphan() {
+	errs := make(chan error)
+	go func() {
+		errs <- nil
+	}()
+}
+`
+
+	graph, err := ExtractGraphFromAST(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	leaks := GoroutineLeaks(graph)
+	if len(leaks) != 1 {
+		t.Fatalf("Expected 1 leak, got %v", leaks)
+	}
+
+	leak := leaks[0]
+	if leak.Goroutine.Name != "orphan.func@32:5" {
+		t.Errorf("Expected the literal of orphan to leak, got %s", leak.Goroutine)
+	}
+	expected := "orphan.func@32:5 spawned at 32:5 may leak: sends on errs at 33:3"
+	if leak.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, leak)
+	}
+}
+
+func TestLockOrderCycles(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+
+import "sync"
+
+var a, b, c sync.Mutex
+
+func first() {
+	a.Lock()
+	defer a.Unlock()
+	b.Lock()
+	b.Unlock()
+}
+
+func second() {
+	b.Lock()
+	lockA()
+	b.Unlock()
+}
+
+func lockA() {
+	a.Lock()
+	a.Unlock()
+}
+
+func third() {
+	c.Lock()
+	c.Unlock()
+	a.Lock()
+	a.Unlock()
+}
+`
+
+	graph, err := ExtractGraphFromAST(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	lg := LockOrderGraph(graph)
+	got := relationEdges(lg, Locks)
+	expected := []string{"(a)-[:Locks]->(b)", "(b)-[:Locks]->(a)"}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected edges %v, got %v", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("Expected edge %s, got %s", expected[i], got[i])
+		}
+	}
+
+	for _, edge := range lg.Edges {
+		if edge.From.Name == "b" && (edge.Attr("func") != "second" || edge.Attr("pos") != "17:2") {
+			t.Errorf("Expected b to be held by second when calling lockA, got %v", edge.Attrs)
+		}
+	}
+
+	cycles := LockOrderCycles(lg)
+	if len(cycles) != 1 {
+		t.Fatalf("Expected 1 cycle, got %v", cycles)
+	}
+	if len(cycles[0]) != 3 || cycles[0][0].Name != "a" || cycles[0][1].Name != "b" || cycles[0][2].Name != "a" {
+		t.Errorf("Expected cycle a -> b -> a, got %v", cycles[0])
+	}
+}
+
+func TestLockOrderCycles_Fields(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+
+import "sync"
+
+type store struct {
+	mu    sync.Mutex
+	index sync.Mutex
+}
+
+type cache struct {
+	sync.Mutex
+}
+
+func (s *store) put() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index.Lock()
+	s.index.Unlock()
+}
+
+func (x *store) reindex() {
+	x.index.Lock()
+	defer x.index.Unlock()
+	x.mu.Lock()
+	x.mu.Unlock()
+}
+
+func local() {
+	var mu sync.Mutex
+	mu.Lock()
+	defer mu.Unlock()
+	var c cache
+	c.Lock()
+	c.Unlock()
+}
+
+func other() {
+	var c cache
+	c.Lock()
+	defer c.Unlock()
+	var mu sync.Mutex
+	mu.Lock()
+	mu.Unlock()
+}
+`
+
+	graph, err := ExtractGraphFromAST(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	// the fields of a type are shared by its methods, and local variables are kept apart
+	if got := countNodeType(graph, Mutex); got != 5 {
+		t.Errorf("Expected 5 mutex nodes, got %d", got)
+	}
+
+	lg := LockOrderGraph(graph)
+	got := relationEdges(lg, Locks)
+	expected := []string{
+		"(cache.Mutex)-[:Locks]->(mu)",
+		"(mu)-[:Locks]->(cache.Mutex)",
+		"(store.index)-[:Locks]->(store.mu)",
+		"(store.mu)-[:Locks]->(store.index)",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected edges %v, got %v", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("Expected edge %s, got %s", expected[i], got[i])
+		}
+	}
+
+	cycles := LockOrderCycles(lg)
+	if len(cycles) != 1 {
+		t.Fatalf("Expected 1 cycle, got %v", cycles)
+	}
+	if len(cycles[0]) != 3 || cycles[0][0].Name != "store.index" || cycles[0][1].Name != "store.mu" {
+		t.Errorf("Expected cycle store.index -> store.mu -> store.index, got %v", cycles[0])
+	}
+}
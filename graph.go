@@ -2,7 +2,6 @@ package astro
 
 import (
 	"fmt"
-	"go/ast"
 	"reflect"
 	"sort"
 )
@@ -11,18 +10,33 @@ import (
 type NodeType string
 
 const (
-	Func    NodeType = "Function"
-	Var     NodeType = "Variable"
-	Unknown NodeType = "Unknown"
+	Func       NodeType = "Function"
+	TestFunc   NodeType = "TestFunction"
+	FuncLit    NodeType = "FunctionLiteral"
+	Var        NodeType = "Variable"
+	Const      NodeType = "Constant"
+	TypeDecl   NodeType = "Type"
+	Package    NodeType = "Package"
+	BasicBlock NodeType = "BasicBlock"
+	Channel    NodeType = "Channel"
+	Mutex      NodeType = "Mutex"
+	TypeParam  NodeType = "TypeParam"
+	Field      NodeType = "Field"
+	Unknown    NodeType = "Unknown"
 )
 
 // Node holds the information of a AST node in the graph.
 //
 // For example, a function declaration node will have the type "FuncDecl"
-// and the function name (or identifier) as the name.
+// and the function name (or identifier) as the name. Methods are named after the
+// type of their receiver and their name, e.g. "Server.Close" for the method Close
+// of *Server, so that the methods of different types sharing a name are kept apart.
 type Node struct {
 	Type NodeType
 	Name string
+
+	// Attrs holds optional metadata of the node, such as its source position.
+	Attrs map[string]string
 }
 
 func NewNode(t NodeType, name string) *Node {
@@ -40,6 +54,19 @@ func (n *Node) SetName(name string) {
 	n.Name = name
 }
 
+// SetAttr sets the attribute key of the node to value.
+func (n *Node) SetAttr(key, value string) {
+	if n.Attrs == nil {
+		n.Attrs = make(map[string]string)
+	}
+	n.Attrs[key] = value
+}
+
+// Attr returns the attribute value for key, or an empty string if it is not set.
+func (n *Node) Attr(key string) string {
+	return n.Attrs[key]
+}
+
 func (n *Node) String() string {
 	return fmt.Sprintf("(%s)", n.Name)
 }
@@ -52,11 +79,33 @@ func (n *Node) String() string {
 type Relation string
 
 const (
-	Call            Relation = "Call"     // function call
-	Declares        Relation = "Declares" // variable declaration
-	Uses            Relation = "Uses"     // variable usage
-	PassesTo        Relation = "PassesTo" // variables passed as function parameters
-	Return 			Relation = "Return"   // function return
+	Call            Relation = "Call"         // function call
+	Declares        Relation = "Declares"     // declaration of a variable, or of a package member
+	Imports         Relation = "Imports"      // package import
+	Uses            Relation = "Uses"         // variable usage
+	PassesTo        Relation = "PassesTo"     // variables passed as function parameters
+	Return          Relation = "Return"       // function return
+	Assigns         Relation = "Assigns"      // value assigned to a variable
+	Defines         Relation = "Defines"      // function defining a function literal
+	Captures        Relation = "Captures"     // function literal capturing a variable of an enclosing function
+	Entry           Relation = "Entry"        // function to its entry basic block
+	Next            Relation = "Next"         // unconditional control flow between basic blocks
+	TrueBranch      Relation = "TrueBranch"   // control flow taken when a condition holds
+	FalseBranch     Relation = "FalseBranch"  // control flow taken when a condition fails
+	Loop            Relation = "Loop"         // back edge to a loop header
+	Spawns          Relation = "Spawns"       // function starting a goroutine running another function
+	Sends           Relation = "Sends"        // function sending on a channel
+	Receives        Relation = "Receives"     // function receiving from a channel
+	Locks           Relation = "Locks"        // function acquiring a mutex
+	Unlocks         Relation = "Unlocks"      // function releasing a mutex
+	Defers          Relation = "Defers"       // deferred function call
+	Panics          Relation = "Panics"       // call of panic or of a function known to panic or exit, besides its call edge
+	Recovers        Relation = "Recovers"     // function deferring a function that calls recover
+	Constraint      Relation = "Constraint"   // type parameter to its constraint
+	Instantiates    Relation = "Instantiates" // function instantiating a generic function
+	ReadsField      Relation = "ReadsField"   // function reading a struct field
+	WritesField     Relation = "WritesField"  // function assigning, incrementing or taking the address of a struct field
+	Writes          Relation = "Writes"       // function writing a package-level variable
 	UnknownRelation Relation = "Unknown"
 )
 
@@ -64,6 +113,9 @@ type Edge struct {
 	From     *Node
 	To       *Node
 	Relation Relation
+
+	// Attrs holds optional metadata of the edge, such as the position it was found at.
+	Attrs map[string]string
 }
 
 func NewEdge(from *Node, to *Node, r Relation) *Edge {
@@ -74,6 +126,19 @@ func NewEdge(from *Node, to *Node, r Relation) *Edge {
 	}
 }
 
+// SetAttr sets the attribute key of the edge to value.
+func (e *Edge) SetAttr(key, value string) {
+	if e.Attrs == nil {
+		e.Attrs = make(map[string]string)
+	}
+	e.Attrs[key] = value
+}
+
+// Attr returns the attribute value for key, or an empty string if it is not set.
+func (e *Edge) Attr(key string) string {
+	return e.Attrs[key]
+}
+
 func (e *Edge) String() string {
 	return fmt.Sprintf("%s-[:%s]->%s", e.From, e.Relation, e.To)
 }
@@ -83,6 +148,9 @@ type Graph struct {
 	Nodes   []*Node
 	Edges   []*Edge
 	NodeMap map[string]*Node
+
+	// Diagnostics holds the problems met while extracting the graph.
+	Diagnostics []Diagnostic
 }
 
 func NewGraph() *Graph {
@@ -98,23 +166,11 @@ func (g *Graph) AddNode(node *Node) {
 	}
 }
 
-func (g *Graph) AddEdge(from, to *Node, relation Relation) {
+func (g *Graph) AddEdge(from, to *Node, relation Relation) *Edge {
 	edge := NewEdge(from, to, relation)
 	g.Edges = append(g.Edges, edge)
-}
-
-func (g *Graph) hasReturn(x *ast.FuncType, currNode *Node) *Graph {
-	if x.Results != nil {
-		for _, result := range x.Results.List {
-			for _, typeName := range result.Names {
-				varNode := NewNode(Var, typeName.Name)
-				g.Nodes = append(g.Nodes, varNode)
-				g.AddEdge(currNode, varNode, Return)
-			}
-		}
-	}
 
-	return g
+	return edge
 }
 
 // DegreeSequence computes and returns a sorted slice of degree sequence of a given graph.
@@ -0,0 +1,250 @@
+package astro
+
+import (
+	"go/ast"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Impact is the set of functions affected by a change of some functions of a graph.
+type Impact struct {
+	Changed []*Node // functions changed, sorted by name
+	Callers []*Node // functions calling a changed function, directly or not, sorted by name
+	Tests   []*Node // tests, fuzz tests and examples reaching a changed function, sorted by name
+	API     []*Node // exported functions changed or reaching a changed function, but tests, sorted by name
+}
+
+// impactRelations holds the relations followed backwards from a changed function to the
+// functions running it.
+var impactRelations = map[Relation]bool{
+	Call:         true,
+	Defers:       true,
+	Spawns:       true,
+	Defines:      true, // a function runs the literals it defines, if any
+	Instantiates: true, // instances run the code of their generic function
+}
+
+// AnalyzeImpact returns the impact of changing the given functions of graph.
+//
+// The callers are found by following the Call edges backwards from the changed
+// functions, along with the Defers and Spawns edges, the Defines edges from the functions
+// to the literals they define, and the Instantiates edges from the instances of generic
+// functions. Calls through a function value or an interface are not followed, like in
+// the rest of the graph. The affected tests are the TestFunc nodes run by go test -run,
+// that is the tests, fuzz tests and examples, which are only in the graph if the test
+// files were extracted; see WithTests.
+func AnalyzeImpact(graph *Graph, changed []*Node) *Impact {
+	callers := make(map[*Node][]*Node)
+	for _, edge := range graph.Edges {
+		if impactRelations[edge.Relation] {
+			callers[edge.To] = append(callers[edge.To], edge.From)
+		}
+	}
+
+	impact := &Impact{}
+	affected := make(map[*Node]bool)
+	queue := make([]*Node, 0, len(changed))
+	for _, node := range changed {
+		if !affected[node] {
+			affected[node] = true
+			impact.Changed = append(impact.Changed, node)
+			queue = append(queue, node)
+		}
+	}
+	for i := 0; i < len(queue); i++ {
+		for _, caller := range callers[queue[i]] {
+			if !isFunction(caller) && caller.Type != FuncLit {
+				continue // e.g. a package initializing a variable
+			}
+			if !affected[caller] {
+				affected[caller] = true
+				impact.Callers = append(impact.Callers, caller)
+				queue = append(queue, caller)
+			}
+		}
+	}
+
+	for _, node := range queue {
+		switch {
+		case isTestFunc(node):
+			impact.Tests = append(impact.Tests, node)
+		case node.Type == Func && ast.IsExported(baseName(node.Name)) && !inTestFile(node):
+			impact.API = append(impact.API, node)
+		}
+	}
+
+	for _, nodes := range [][]*Node{impact.Changed, impact.Callers, impact.Tests, impact.API} {
+		sort.Slice(nodes, func(i, j int) bool {
+			return nodes[i].Name < nodes[j].Name
+		})
+	}
+
+	return impact
+}
+
+// TestPattern returns a pattern selecting the affected tests with the -run flag of go
+// test, e.g. "^(TestOpen|TestServe)$", or an empty string if no test is affected.
+func (i *Impact) TestPattern() string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, test := range i.Tests {
+		name := baseName(test.Name)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, regexp.QuoteMeta(name))
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return "^(" + strings.Join(names, "|") + ")$"
+}
+
+// baseName returns the name of a function without its package qualifier.
+func baseName(name string) string {
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// inTestFile reports whether node was declared in a test file.
+func inTestFile(node *Node) bool {
+	file, _, ok := parsePosition(node.Attr("pos"))
+	return ok && strings.HasSuffix(file, "_test.go")
+}
+
+// isTestFunc reports whether node is a test function run by go test -run.
+func isTestFunc(node *Node) bool {
+	kind := node.Attr("kind")
+	return node.Type == TestFunc && (kind == "test" || kind == "fuzz" || kind == "example")
+}
+
+// ChangedFuncs returns the functions changed by d, sorted by name: the functions added or
+// whose attributes changed, the functions whose edges were added, removed or changed,
+// and the functions declaring the variables added, removed or changed. The functions
+// are nodes of the graph after the change, to be analyzed with AnalyzeImpact on it.
+//
+// A diff only sees the changes of the graph, so edits leaving the graph unchanged, such
+// as changing a literal value, are missed; FuncsInRanges maps the lines changed in the
+// sources to functions instead.
+func ChangedFuncs(d *GraphDiff) []*Node {
+	byName := make(map[string]*Node)
+	for _, node := range d.after {
+		if isFunction(node) || node.Type == FuncLit {
+			byName[node.Name] = node
+		}
+	}
+
+	seen := make(map[*Node]bool)
+	var funcs []*Node
+	add := func(n *Node) {
+		switch {
+		case isFunction(n) || n.Type == FuncLit:
+			// nodes of the graph before the change are mapped to the graph after it
+			n = d.after[d.ids[n]]
+		case n.Attr("scope") != "":
+			n = byName[n.Attr("scope")]
+		default:
+			return
+		}
+		if n != nil && !seen[n] {
+			seen[n] = true
+			funcs = append(funcs, n)
+		}
+	}
+
+	for _, nodes := range [][]*Node{d.AddedNodes, d.RemovedNodes} {
+		for _, node := range nodes {
+			add(node)
+		}
+	}
+	for _, c := range d.ChangedNodes {
+		add(c.After)
+	}
+	for _, edges := range [][]*Edge{d.AddedEdges, d.RemovedEdges} {
+		for _, edge := range edges {
+			add(edge.From)
+		}
+	}
+	for _, c := range d.ChangedEdges {
+		add(c.After.From)
+	}
+
+	sort.Slice(funcs, func(i, j int) bool {
+		return funcs[i].Name < funcs[j].Name
+	})
+	return funcs
+}
+
+// LineRange is a range of lines of a source file, such as a hunk of a diff.
+type LineRange struct {
+	File  string
+	Start int // first line, from 1
+	End   int // last line, included
+}
+
+// FuncsInRanges returns the functions and function literals of graph whose source
+// overlaps one of ranges, sorted by name. Files are matched by their absolute path.
+// Functions are located by their "pos" and "end" attributes, so the ranges of a graph
+// extracted from a single source have no file name.
+func FuncsInRanges(graph *Graph, ranges []LineRange) []*Node {
+	var funcs []*Node
+	for _, node := range graph.Nodes {
+		if !isFunction(node) && node.Type != FuncLit {
+			continue
+		}
+		file, start, ok := parsePosition(node.Attr("pos"))
+		if !ok {
+			continue
+		}
+		_, end, ok := parsePosition(node.Attr("end"))
+		if !ok {
+			continue
+		}
+		for _, r := range ranges {
+			if sameFile(file, r.File) && r.Start <= end && start <= r.End {
+				funcs = append(funcs, node)
+				break
+			}
+		}
+	}
+
+	sort.Slice(funcs, func(i, j int) bool {
+		return funcs[i].Name < funcs[j].Name
+	})
+	return funcs
+}
+
+// parsePosition parses a position formatted like token.Position, "file:line:column" or
+// "line:column", into its file and line.
+func parsePosition(pos string) (file string, line int, ok bool) {
+	i := strings.LastIndex(pos, ":")
+	if i < 0 {
+		return "", 0, false
+	}
+	rest := pos[:i]
+	j := strings.LastIndex(rest, ":")
+	line, err := strconv.Atoi(rest[j+1:])
+	if err != nil {
+		return "", 0, false
+	}
+	if j >= 0 {
+		file = rest[:j]
+	}
+	return file, line, true
+}
+
+// sameFile reports whether the paths a and b name the same file.
+func sameFile(a, b string) bool {
+	if a == b {
+		return true
+	}
+	if a == "" || b == "" {
+		return false
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
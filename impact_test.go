@@ -0,0 +1,247 @@
+package astro
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var impactModule = map[string]string{
+	"go.mod": "module example.com/app\n\ngo 1.21\n",
+	"main.go": `package main
+
+import "example.com/app/store"
+
+func main() {
+	store.Open("db")
+}
+`,
+	"store/store.go": `package store
+
+func Open(name string) error {
+	return validate(name)
+}
+
+func Close() {
+	func() {
+		cleanup()
+	}()
+}
+
+func validate(name string) error {
+	return nil
+}
+
+func cleanup() {}
+
+type Conn struct{}
+
+func (c *Conn) Close() {
+	c.reset()
+}
+
+func (c *Conn) reset() {}
+
+type File struct{}
+
+func (File) Close() {}
+`,
+	"store/store_test.go": `package store
+
+import "testing"
+
+func TestOpen(t *testing.T) {
+	Open("test")
+}
+
+func TestClose(t *testing.T) {
+	Close()
+}
+
+func Testing() {
+	validate("")
+}
+
+func TestConn(t *testing.T) {
+	new(Conn).Close()
+}
+`,
+}
+
+func TestAnalyzeImpact(t *testing.T) {
+	t.Parallel()
+
+	root := writeTree(t, impactModule)
+	graph, err := NewBuilder(WithTests(true)).ExtractDir(root)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		changed []string
+		callers string
+		tests   string
+		api     string
+		pattern string
+	}{
+		{
+			name:    "unexported function",
+			changed: []string{"example.com/app/store.validate"},
+			callers: "example.com/app.main, example.com/app/store.Open, example.com/app/store.TestOpen, example.com/app/store.Testing",
+			tests:   "example.com/app/store.TestOpen",
+			api:     "example.com/app/store.Open",
+			pattern: "^(TestOpen)$",
+		},
+		{
+			name:    "through function literal",
+			changed: []string{"example.com/app/store.cleanup"},
+			callers: "example.com/app/store.Close, example.com/app/store.Close.func@8:2, example.com/app/store.TestClose",
+			tests:   "example.com/app/store.TestClose",
+			api:     "example.com/app/store.Close",
+			pattern: "^(TestClose)$",
+		},
+		{
+			name:    "method",
+			changed: []string{"example.com/app/store.Conn.reset"},
+			callers: "example.com/app/store.Conn.Close, example.com/app/store.TestConn",
+			tests:   "example.com/app/store.TestConn",
+			api:     "example.com/app/store.Conn.Close",
+			pattern: "^(TestConn)$",
+		},
+		{
+			name:    "method of the same name",
+			changed: []string{"example.com/app/store.File.Close"},
+			api:     "example.com/app/store.File.Close",
+		},
+		{
+			name:    "entry point",
+			changed: []string{"example.com/app.main"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var changed []*Node
+			for _, name := range tt.changed {
+				node := findNode(graph, Func, name)
+				if node == nil {
+					t.Fatalf("Expected function %s in the graph", name)
+				}
+				changed = append(changed, node)
+			}
+
+			impact := AnalyzeImpact(graph, changed)
+			if got := nodeNames(impact.Changed); got != strings.Join(tt.changed, ", ") {
+				t.Errorf("Expected changed %s, got %s", strings.Join(tt.changed, ", "), got)
+			}
+			if got := nodeNames(impact.Callers); got != tt.callers {
+				t.Errorf("Expected callers %s, got %s", tt.callers, got)
+			}
+			if got := nodeNames(impact.Tests); got != tt.tests {
+				t.Errorf("Expected tests %s, got %s", tt.tests, got)
+			}
+			if got := nodeNames(impact.API); got != tt.api {
+				t.Errorf("Expected API %s, got %s", tt.api, got)
+			}
+			if got := impact.TestPattern(); got != tt.pattern {
+				t.Errorf("Expected pattern %q, got %q", tt.pattern, got)
+			}
+		})
+	}
+}
+
+func TestFuncsInRanges(t *testing.T) {
+	t.Parallel()
+
+	root := writeTree(t, impactModule)
+	graph, err := ExtractGraphFromDir(root)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+	file := filepath.Join(root, "store", "store.go")
+
+	tests := []struct {
+		name     string
+		ranges   []LineRange
+		expected string
+	}{
+		{"function body", []LineRange{{file, 14, 14}}, "example.com/app/store.validate"},
+		{"function literal", []LineRange{{file, 9, 9}}, "example.com/app/store.Close, example.com/app/store.Close.func@8:2"},
+		{"several functions", []LineRange{{file, 5, 7}}, "example.com/app/store.Close, example.com/app/store.Open"},
+		{"between functions", []LineRange{{file, 12, 12}}, ""},
+		{"other file", []LineRange{{filepath.Join(root, "main.go"), 14, 14}}, ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := nodeNames(FuncsInRanges(graph, tt.ranges)); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestChangedFuncs(t *testing.T) {
+	t.Parallel()
+
+	before := writeTree(t, impactModule)
+	after := writeTree(t, impactModule)
+	src := `package store
+
+func Open(name string) error {
+	return validate(name)
+}
+
+func Close() {
+	func() {
+		cleanup()
+	}()
+}
+
+func validate(name string) error {
+	if name == "" {
+		return check()
+	}
+	return nil
+}
+
+func check() error {
+	return nil
+}
+
+func cleanup() {}
+`
+	if err := os.WriteFile(filepath.Join(after, "store", "store.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	g1, err := ExtractGraphFromDir(before)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+	graph, err := ExtractGraphFromDir(after)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	changed := ChangedFuncs(Diff(g1, graph))
+	if got := nodeNames(changed); got != "example.com/app/store.check, example.com/app/store.validate" {
+		t.Errorf("Expected check and validate to change, got %s", got)
+	}
+	for _, node := range changed {
+		if findNode(graph, node.Type, node.Name) != node {
+			t.Errorf("Expected %s to be a function of the graph after the change", node.Name)
+		}
+	}
+	if got := nodeNames(AnalyzeImpact(graph, changed).API); got != "example.com/app/store.Open" {
+		t.Errorf("Expected Open to be affected, got %s", got)
+	}
+}
@@ -0,0 +1,238 @@
+package astro
+
+import (
+	"go/types"
+	"strings"
+)
+
+// Qualification tells how the functions of the extracted packages are named.
+type Qualification int
+
+const (
+	QualifyDefault Qualification = iota // QualifyNone for a single file, QualifyPath for a directory
+	QualifyNone                         // bare names, e.g. "Open"
+	QualifyPackage                      // package name, e.g. "db.Open"
+	QualifyPath                         // import path, e.g. "example.com/app/db.Open"
+)
+
+// Builder extracts graphs tailored by its options.
+//
+// A Builder without options extracts the same graphs as ExtractGraphFromAST and
+// ExtractGraphFromDir. Options either change how the source is extracted, or filter
+// the extracted graph; filters apply in the order node types, relations, stdlib
+// callees, then hooks. Removing a node removes the edges it takes part in.
+type Builder struct {
+	opts extractOptions
+
+	nodeTypes map[NodeType]bool
+	relations map[Relation]bool
+	noStdlib  bool
+	nodeHooks []func(n *Node) bool
+	edgeHooks []func(e *Edge) bool
+}
+
+// Option configures a Builder.
+type Option func(b *Builder)
+
+// NewBuilder returns a Builder configured with the given options.
+func NewBuilder(opts ...Option) *Builder {
+	b := &Builder{}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// WithNodeTypes keeps only the nodes of the given types.
+func WithNodeTypes(nodeTypes ...NodeType) Option {
+	return func(b *Builder) {
+		b.nodeTypes = make(map[NodeType]bool)
+		for _, t := range nodeTypes {
+			b.nodeTypes[t] = true
+		}
+	}
+}
+
+// WithRelations keeps only the edges of the given relations.
+func WithRelations(relations ...Relation) Option {
+	return func(b *Builder) {
+		b.relations = make(map[Relation]bool)
+		for _, r := range relations {
+			b.relations[r] = true
+		}
+	}
+}
+
+// WithStdlib tells whether to keep the callees of the standard library and the builtin
+// functions. They are kept by default.
+func WithStdlib(include bool) Option {
+	return func(b *Builder) {
+		b.noStdlib = !include
+	}
+}
+
+// WithTests tells whether to extract the test files of directories. They are skipped
+// by default. The tests, benchmarks, fuzz tests and examples of test files are extracted
+// as TestFunc nodes, with their kind in the "kind" attribute.
+func WithTests(include bool) Option {
+	return func(b *Builder) {
+		b.opts.tests = include
+	}
+}
+
+// WithQualification sets how the functions of the extracted packages are named.
+func WithQualification(q Qualification) Option {
+	return func(b *Builder) {
+		b.opts.qualification = q
+	}
+}
+
+// WithMaxFileSize skips the files larger than size bytes, reporting them as diagnostics.
+func WithMaxFileSize(size int64) Option {
+	return func(b *Builder) {
+		b.opts.maxFileSize = size
+	}
+}
+
+// WithCFG tells whether to build the control-flow graph of every function declaration.
+func WithCFG(enabled bool) Option {
+	return func(b *Builder) {
+		b.opts.withCFG = enabled
+	}
+}
+
+// WithMode sets how diagnostics are handled. Setting a mode also extracts files with
+// syntax errors as far as possible, unless they fail a strict extraction.
+func WithMode(mode Mode) Option {
+	return func(b *Builder) {
+		b.opts.mode = mode
+		b.opts.partial = true
+	}
+}
+
+// WithPlugins runs the given plugins while extracting, in order.
+func WithPlugins(plugins ...Plugin) Option {
+	return func(b *Builder) {
+		b.opts.plugins = append(b.opts.plugins, plugins...)
+	}
+}
+
+// WithInstances tells whether to extract a node per instantiation of generic functions,
+// named after its type arguments, e.g. "Map[int, string]". Calls then reach the instance,
+// which is linked to the generic function by an Instantiates edge. Generic functions are
+// a single node by default, with an Instantiates edge from every call site.
+func WithInstances(separate bool) Option {
+	return func(b *Builder) {
+		b.opts.instances = separate
+	}
+}
+
+// WithNodeHook calls hook on every node of the extracted graph. The node is removed
+// if hook returns false. Hooks may also modify the node, e.g. to add attributes.
+func WithNodeHook(hook func(n *Node) bool) Option {
+	return func(b *Builder) {
+		b.nodeHooks = append(b.nodeHooks, hook)
+	}
+}
+
+// WithEdgeHook calls hook on every edge of the extracted graph, once the nodes were
+// filtered. The edge is removed if hook returns false.
+func WithEdgeHook(hook func(e *Edge) bool) Option {
+	return func(b *Builder) {
+		b.edgeHooks = append(b.edgeHooks, hook)
+	}
+}
+
+// Extract extracts the graph of a single source file.
+func (b *Builder) Extract(src string) (*Graph, error) {
+	graph, err := extractGraph(src, b.opts)
+	if err != nil {
+		return nil, err
+	}
+	return b.filter(graph), nil
+}
+
+// ExtractDir extracts a single graph from every package found under root, like
+// ExtractGraphFromDir.
+func (b *Builder) ExtractDir(root string) (*Graph, error) {
+	graph, err := extractDir(root, b.opts)
+	if err != nil {
+		return nil, err
+	}
+	return b.filter(graph), nil
+}
+
+// filter removes the nodes and edges the options leave out of graph.
+func (b *Builder) filter(graph *Graph) *Graph {
+	keep := make(map[*Node]bool)
+	var nodes []*Node
+	for _, node := range graph.Nodes {
+		if b.keepNode(node) {
+			keep[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+
+	graph.Nodes = nodes
+	for name, node := range graph.NodeMap {
+		if !keep[node] {
+			delete(graph.NodeMap, name)
+		}
+	}
+
+	var edges []*Edge
+	for _, edge := range graph.Edges {
+		if keep[edge.From] && keep[edge.To] && b.keepEdge(edge) {
+			edges = append(edges, edge)
+		}
+	}
+	graph.Edges = edges
+
+	return graph
+}
+
+func (b *Builder) keepNode(node *Node) bool {
+	if b.nodeTypes != nil && !b.nodeTypes[node.Type] {
+		return false
+	}
+	if b.noStdlib && node.Type == Func && isStdlibFunc(node) {
+		return false
+	}
+	for _, hook := range b.nodeHooks {
+		if !hook(node) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Builder) keepEdge(edge *Edge) bool {
+	if b.relations != nil && !b.relations[edge.Relation] {
+		return false
+	}
+	for _, hook := range b.edgeHooks {
+		if !hook(edge) {
+			return false
+		}
+	}
+	return true
+}
+
+// isStdlibFunc reports whether the function node is a builtin function, or a function
+// of a standard library package, whose import path has no dot in its first element.
+// Functions declared in the extracted source, which have a position, are never part
+// of the standard library.
+func isStdlibFunc(node *Node) bool {
+	if node.Attr("pos") != "" {
+		return false
+	}
+
+	pkg := node.Attr("pkg")
+	if pkg == "" {
+		_, builtin := types.Universe.Lookup(node.Name).(*types.Builtin)
+		return builtin
+	}
+
+	first, _, _ := strings.Cut(pkg, "/")
+	return !strings.Contains(first, ".")
+}
@@ -0,0 +1,156 @@
+package astro
+
+import (
+	"strings"
+	"testing"
+)
+
+const builderSrc = `
+package main
+
+import "fmt"
+
+var greeting = "hello"
+
+func main() {
+	helper(greeting)
+	fmt.Println(len(greeting))
+}
+
+func helper(s string) {
+	println(s)
+}
+`
+
+func TestBuilder_Filters(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		expected []string
+	}{
+		{
+			name:     "calls only",
+			opts:     []Option{WithNodeTypes(Func), WithRelations(Call)},
+			expected: []string{"(main)-[:Call]->(helper)", "(main)-[:Call]->(fmt.Println)", "(main)-[:Call]->(len)", "(helper)-[:Call]->(println)"},
+		},
+		{
+			name:     "without stdlib",
+			opts:     []Option{WithRelations(Call), WithStdlib(false)},
+			expected: []string{"(main)-[:Call]->(helper)"},
+		},
+		{
+			name:     "package qualification",
+			opts:     []Option{WithRelations(Call), WithStdlib(false), WithQualification(QualifyPackage)},
+			expected: []string{"(main.main)-[:Call]->(main.helper)"},
+		},
+		{
+			name: "hooks",
+			opts: []Option{
+				WithRelations(Call, Uses),
+				WithNodeHook(func(n *Node) bool { return n.Name != "len" }),
+				WithEdgeHook(func(e *Edge) bool { return e.From.Name == "main" }),
+			},
+			expected: []string{"(main)-[:Call]->(helper)", "(main)-[:Uses]->(greeting)", "(main)-[:Call]->(fmt.Println)", "(main)-[:Uses]->(greeting)"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			graph, err := NewBuilder(tc.opts...).Extract(builderSrc)
+			if err != nil {
+				t.Fatalf("Error extracting graph: %s", err)
+			}
+
+			var got []string
+			for _, edge := range graph.Edges {
+				got = append(got, edge.String())
+			}
+			if strings.Join(got, " ") != strings.Join(tc.expected, " ") {
+				t.Errorf("Expected edges %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestBuilder_Extraction(t *testing.T) {
+	t.Parallel()
+
+	graph, err := NewBuilder(WithCFG(true), WithNodeTypes(Func, BasicBlock)).Extract(builderSrc)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+	if countNodeType(graph, BasicBlock) == 0 {
+		t.Errorf("Expected basic blocks")
+	}
+	if got := countNodeType(graph, Var); got != 0 {
+		t.Errorf("Expected no variable nodes, got %d", got)
+	}
+
+	graph, err = NewBuilder(WithMaxFileSize(10)).Extract(builderSrc)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+	if len(graph.Nodes) != 0 || len(graph.Diagnostics) != 1 || graph.Diagnostics[0].Kind != DiagnosticSkipped {
+		t.Errorf("Expected the file to be skipped, got %v and %v", graph.Nodes, graph.Diagnostics)
+	}
+
+	if _, err := NewBuilder(WithMaxFileSize(10), WithMode(Strict)).Extract(builderSrc); err == nil {
+		t.Errorf("Expected a strict extraction of a skipped file to fail")
+	}
+}
+
+func TestBuilder_ExtractDir(t *testing.T) {
+	t.Parallel()
+
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.21\n",
+		"db/db.go": `package db
+
+func Open() {}
+`,
+		"db/db_test.go": `package db
+
+func TestOpen() {
+	Open()
+}
+`,
+		"db/example_test.go": `package db_test
+
+import "example.com/app/db"
+
+func ExampleOpen() {
+	db.Open()
+}
+`,
+		"db/big.go": "package db\n\n// " + strings.Repeat("x", 100) + "\nfunc Big() {}\n",
+	})
+
+	graph, err := NewBuilder(WithTests(true), WithMaxFileSize(80)).ExtractDir(root)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	for _, name := range []string{"example.com/app/db.TestOpen", "example.com/app/db_test.ExampleOpen"} {
+		if graph.NodeMap[name] == nil {
+			t.Errorf("Expected test function %s", name)
+		}
+	}
+	if findNode(graph, Package, "example.com/app/db_test") == nil {
+		t.Errorf("Expected the external test package to be a package of its own")
+	}
+	if graph.NodeMap["example.com/app/db.Big"] != nil {
+		t.Errorf("Expected the large file to be skipped")
+	}
+
+	var calls int
+	for _, edge := range graph.Edges {
+		if edge.Relation == Call && edge.To.Name == "example.com/app/db.Open" {
+			calls++
+		}
+	}
+	if calls != 2 {
+		t.Errorf("Expected Open to be called by both tests, got %d calls", calls)
+	}
+}
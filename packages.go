@@ -0,0 +1,264 @@
+package astro
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PackageGraph collapses graph into a package dependency graph.
+//
+// The resulting graph contains a copy of every Package node of graph, connected by
+// Imports edges, and by Call edges wherever a function or function literal of a package
+// calls a function of another package, including the calls of go and defer statements.
+// Parallel edges are merged, and the number of merged edges is recorded in the "weight"
+// attribute of the remaining edge.
+//
+// Functions are attributed to packages through their "pkg" attribute, so calls to
+// functions whose package is unknown (e.g. builtins or method calls) are ignored.
+func PackageGraph(graph *Graph) *Graph {
+	pg := NewGraph()
+	for _, node := range graph.Nodes {
+		if node.Type == Package {
+			pkg := NewNode(Package, node.Name)
+			for k, v := range node.Attrs {
+				pkg.SetAttr(k, v)
+			}
+			pg.AddNode(pkg)
+		}
+	}
+
+	type key struct {
+		from, to string
+		relation Relation
+	}
+	weights := make(map[key]int)
+	var order []key
+
+	add := func(from, to string, r Relation) {
+		if from == "" || to == "" || from == to {
+			return
+		}
+		k := key{from, to, r}
+		if weights[k] == 0 {
+			order = append(order, k)
+		}
+		weights[k]++
+	}
+
+	for _, edge := range graph.Edges {
+		switch {
+		case edge.Relation == Imports:
+			add(edge.From.Name, edge.To.Name, Imports)
+		case isCall(edge.Relation) && (isFunction(edge.From) || edge.From.Type == FuncLit):
+			add(edge.From.Attr("pkg"), edge.To.Attr("pkg"), Call)
+		}
+	}
+
+	for _, k := range order {
+		from, to := pg.NodeMap[k.from], pg.NodeMap[k.to]
+		if from == nil || to == nil {
+			continue
+		}
+		edge := pg.AddEdge(from, to, k.relation)
+		edge.SetAttr("weight", strconv.Itoa(weights[k]))
+	}
+
+	return pg
+}
+
+// isCall reports whether r relates a function to a function it calls. Calls known to
+// panic have a Call edge besides their Panics edge, so Panics is left out.
+func isCall(r Relation) bool {
+	return r == Call || r == Spawns || r == Defers
+}
+
+// ImportCycles returns the import cycles of a package graph, as paths starting and
+// ending at the same package.
+//
+// A cycle is reported for every strongly connected component of the Imports edges
+// containing more than one package, so packages involved in several intertwined cycles
+// are reported once.
+func ImportCycles(pg *Graph) [][]*Node {
+	return cycles(pg, func(e *Edge) bool {
+		return e.Relation == Imports
+	})
+}
+
+// cycles returns a cycle through every strongly connected component of graph over the
+// edges accepted by follow, as paths starting and ending at the first node of the component.
+func cycles(graph *Graph, follow func(e *Edge) bool) [][]*Node {
+	var result [][]*Node
+	for _, component := range stronglyConnected(graph, follow) {
+		if len(component) < 2 {
+			continue
+		}
+
+		start := component[0]
+		inComponent := make(map[*Node]bool)
+		for _, node := range component {
+			inComponent[node] = true
+		}
+
+		// close the cycle by searching a path back to start from one of its successors
+		for _, edge := range graph.Edges {
+			if edge.From != start || !follow(edge) || !inComponent[edge.To] {
+				continue
+			}
+			path, found := MultiPathPruningFunc(graph, edge.To, func(n *Node) bool {
+				return n == start
+			}, follow)
+			if found {
+				result = append(result, append([]*Node{start}, path...))
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// stronglyConnected returns the strongly connected components of graph over the edges
+// accepted by follow, using Tarjan's algorithm. Components are sorted by the name of
+// their first node, and the nodes of a component by name.
+func stronglyConnected(graph *Graph, follow func(e *Edge) bool) [][]*Node {
+	adjacency := make(map[*Node][]*Node)
+	for _, edge := range graph.Edges {
+		if follow(edge) {
+			adjacency[edge.From] = append(adjacency[edge.From], edge.To)
+		}
+	}
+
+	index := make(map[*Node]int)
+	lowlink := make(map[*Node]int)
+	onStack := make(map[*Node]bool)
+	var stack []*Node
+	var components [][]*Node
+
+	var visit func(n *Node)
+	visit = func(n *Node) {
+		index[n] = len(index)
+		lowlink[n] = index[n]
+		stack = append(stack, n)
+		onStack[n] = true
+
+		for _, m := range adjacency[n] {
+			if _, seen := index[m]; !seen {
+				visit(m)
+				lowlink[n] = min(lowlink[n], lowlink[m])
+			} else if onStack[m] {
+				lowlink[n] = min(lowlink[n], index[m])
+			}
+		}
+
+		if lowlink[n] == index[n] {
+			var component []*Node
+			for {
+				m := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[m] = false
+				component = append(component, m)
+				if m == n {
+					break
+				}
+			}
+			sort.Slice(component, func(i, j int) bool {
+				return component[i].Name < component[j].Name
+			})
+			components = append(components, component)
+		}
+	}
+
+	for _, node := range graph.Nodes {
+		if _, seen := index[node]; !seen {
+			visit(node)
+		}
+	}
+
+	sort.Slice(components, func(i, j int) bool {
+		return components[i][0].Name < components[j][0].Name
+	})
+
+	return components
+}
+
+// LayerRule forbids the packages matching From to import the packages matching To,
+// directly or through other packages.
+//
+// A pattern matches a package whose import path equals it or ends with "/" followed by
+// it, so "internal/db" matches "example.com/app/internal/db". A pattern ending in "/..."
+// also matches the packages below it.
+type LayerRule struct {
+	From string
+	To   string
+}
+
+// ParseLayerRule parses a rule written as "<from> must not import <to>".
+func ParseLayerRule(rule string) (LayerRule, error) {
+	from, to, ok := strings.Cut(rule, " must not import ")
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if !ok || from == "" || to == "" {
+		return LayerRule{}, fmt.Errorf("invalid layer rule %q: expected \"<from> must not import <to>\"", rule)
+	}
+
+	return LayerRule{From: from, To: to}, nil
+}
+
+func (r LayerRule) String() string {
+	return fmt.Sprintf("%s must not import %s", r.From, r.To)
+}
+
+// LayerViolation is an import path breaking a layering rule.
+type LayerViolation struct {
+	Rule LayerRule
+	Path []*Node // packages from the importing package to the forbidden one
+}
+
+func (v LayerViolation) String() string {
+	names := make([]string, len(v.Path))
+	for i, node := range v.Path {
+		names[i] = node.Name
+	}
+	return fmt.Sprintf("%s: %s", v.Rule, strings.Join(names, " -> "))
+}
+
+// CheckLayers reports the imports of a package graph violating the given rules. For every
+// package matching the From pattern of a rule, the shortest import path to a package
+// matching the To pattern is reported.
+func CheckLayers(pg *Graph, rules []LayerRule) []LayerViolation {
+	imports := func(e *Edge) bool {
+		return e.Relation == Imports
+	}
+
+	var violations []LayerViolation
+	for _, rule := range rules {
+		for _, node := range pg.Nodes {
+			if node.Type != Package || !matchPackage(rule.From, node.Name) {
+				continue
+			}
+
+			path, found := MultiPathPruningFunc(pg, node, func(n *Node) bool {
+				return n != node && matchPackage(rule.To, n.Name)
+			}, imports)
+			if found {
+				violations = append(violations, LayerViolation{Rule: rule, Path: path})
+			}
+		}
+	}
+
+	return violations
+}
+
+// matchPackage reports whether the import path matches a layer rule pattern.
+func matchPackage(pattern, path string) bool {
+	base, recursive := strings.CutSuffix(pattern, "/...")
+	if path == base || strings.HasSuffix(path, "/"+base) {
+		return true
+	}
+	if !recursive {
+		return false
+	}
+
+	return strings.HasPrefix(path, base+"/") || strings.Contains(path, "/"+base+"/")
+}
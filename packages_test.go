@@ -0,0 +1,282 @@
+package astro
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTree writes files, keyed by slash separated relative paths, under a temporary directory.
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+var layeredModule = map[string]string{
+	"go.mod": "module example.com/app\n\ngo 1.21\n",
+	"cmd/app/main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/app/internal/db"
+)
+
+func main() {
+	db.Open()
+	db.Open()
+	fmt.Println("done")
+}
+`,
+	"internal/db/db.go": `package db
+
+import "example.com/app/internal/http"
+
+func Open() {
+	http.Serve()
+}
+`,
+	"internal/db/db_test.go": `package db
+
+func TestOpen() {}
+`,
+	"internal/http/http.go": `package http
+
+import "example.com/app/internal/db"
+
+func Serve() {
+	db.Open()
+	helper()
+}
+`,
+	"internal/http/helper.go": `package http
+
+func helper() {}
+`,
+}
+
+func TestExtractGraphFromDir(t *testing.T) {
+	t.Parallel()
+
+	graph, err := ExtractGraphFromDir(writeTree(t, layeredModule))
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	for _, name := range []string{
+		"example.com/app/cmd/app",
+		"example.com/app/internal/db",
+		"example.com/app/internal/http",
+		"fmt",
+	} {
+		if findNode(graph, Package, name) == nil {
+			t.Errorf("Expected package node %s", name)
+		}
+	}
+
+	if got := countNodeType(graph, Package); got != 4 {
+		t.Errorf("Expected a single node per package, got %d package nodes", got)
+	}
+
+	open := graph.NodeMap["example.com/app/internal/db.Open"]
+	if open == nil {
+		t.Fatalf("Expected a qualified node for db.Open, got %v", graph.Nodes)
+	}
+	if open.Attr("pkg") != "example.com/app/internal/db" {
+		t.Errorf("Expected db.Open to belong to internal/db, got %q", open.Attr("pkg"))
+	}
+
+	// helper is declared in another file of the same package
+	var calls int
+	for _, edge := range graph.Edges {
+		if edge.Relation == Call && edge.From.Name == "example.com/app/internal/http.Serve" &&
+			edge.To.Name == "example.com/app/internal/http.helper" {
+			calls++
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected Serve to call the helper of its package, got %d calls", calls)
+	}
+
+	if graph.NodeMap["example.com/app/internal/db.TestOpen"] != nil {
+		t.Errorf("Expected test files to be skipped")
+	}
+}
+
+func TestPackageGraph(t *testing.T) {
+	t.Parallel()
+
+	graph, err := ExtractGraphFromDir(writeTree(t, layeredModule))
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	pg := PackageGraph(graph)
+	if len(pg.Nodes) != 4 {
+		t.Errorf("Expected 4 packages, got %v", pg.Nodes)
+	}
+
+	weights := make(map[string]string)
+	for _, edge := range pg.Edges {
+		if edge.From.Type != Package || edge.To.Type != Package {
+			t.Errorf("Expected only package nodes, got %s", edge)
+		}
+		weights[edge.String()] = edge.Attr("weight")
+	}
+
+	expected := map[string]string{
+		"(example.com/app/cmd/app)-[:Imports]->(fmt)":                               "1",
+		"(example.com/app/cmd/app)-[:Imports]->(example.com/app/internal/db)":       "1",
+		"(example.com/app/cmd/app)-[:Call]->(example.com/app/internal/db)":          "2",
+		"(example.com/app/cmd/app)-[:Call]->(fmt)":                                  "1",
+		"(example.com/app/internal/db)-[:Imports]->(example.com/app/internal/http)": "1",
+		"(example.com/app/internal/db)-[:Call]->(example.com/app/internal/http)":    "1",
+		"(example.com/app/internal/http)-[:Imports]->(example.com/app/internal/db)": "1",
+		"(example.com/app/internal/http)-[:Call]->(example.com/app/internal/db)":    "1",
+	}
+	if len(weights) != len(expected) {
+		t.Errorf("Expected edges %v, got %v", expected, weights)
+	}
+	for edge, weight := range expected {
+		if weights[edge] != weight {
+			t.Errorf("Expected %s with weight %s, got %q", edge, weight, weights[edge])
+		}
+	}
+}
+
+func TestPackageGraph_IndirectCalls(t *testing.T) {
+	t.Parallel()
+
+	graph, err := ExtractGraphFromDir(writeTree(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.21\n",
+		"a/a.go": `package a
+
+import (
+	"example.com/app/b"
+	"example.com/app/c"
+	"example.com/app/d"
+)
+
+func Run() {
+	go b.F()
+	defer d.MustH()
+	func() {
+		c.G()
+	}()
+}
+`,
+		"b/b.go": "package b\n\nfunc F() {}\n",
+		"c/c.go": "package c\n\nfunc G() {}\n",
+		"d/d.go": "package d\n\nfunc MustH() {}\n",
+	}))
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	calls := make(map[string]string)
+	for _, edge := range PackageGraph(graph).Edges {
+		if edge.Relation == Call {
+			calls[edge.String()] = edge.Attr("weight")
+		}
+	}
+	expected := []string{
+		"(example.com/app/a)-[:Call]->(example.com/app/b)",
+		"(example.com/app/a)-[:Call]->(example.com/app/c)",
+		"(example.com/app/a)-[:Call]->(example.com/app/d)",
+	}
+	if len(calls) != len(expected) {
+		t.Errorf("Expected calls %v, got %v", expected, calls)
+	}
+	for _, edge := range expected {
+		if calls[edge] != "1" {
+			t.Errorf("Expected %s with weight 1, got %q", edge, calls[edge])
+		}
+	}
+}
+
+func TestImportCycles(t *testing.T) {
+	t.Parallel()
+
+	graph, err := ExtractGraphFromDir(writeTree(t, layeredModule))
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	cycles := ImportCycles(PackageGraph(graph))
+	if len(cycles) != 1 {
+		t.Fatalf("Expected 1 import cycle, got %v", cycles)
+	}
+
+	expected := []string{"example.com/app/internal/db", "example.com/app/internal/http", "example.com/app/internal/db"}
+	if len(cycles[0]) != len(expected) {
+		t.Fatalf("Expected cycle %v, got %v", expected, cycles[0])
+	}
+	for i, node := range cycles[0] {
+		if node.Name != expected[i] {
+			t.Errorf("Expected %s at position %d, got %s", expected[i], i, node.Name)
+		}
+	}
+}
+
+func TestCheckLayers(t *testing.T) {
+	t.Parallel()
+
+	graph, err := ExtractGraphFromDir(writeTree(t, layeredModule))
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+	pg := PackageGraph(graph)
+
+	tests := []struct {
+		rule     string
+		expected []string
+	}{
+		{
+			rule:     "internal/db must not import internal/http",
+			expected: []string{"internal/db must not import internal/http: example.com/app/internal/db -> example.com/app/internal/http"},
+		},
+		{
+			rule:     "cmd/... must not import internal/http",
+			expected: []string{"cmd/... must not import internal/http: example.com/app/cmd/app -> example.com/app/internal/db -> example.com/app/internal/http"},
+		},
+		{
+			rule:     "internal/http must not import fmt",
+			expected: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.rule, func(t *testing.T) {
+			rule, err := ParseLayerRule(tc.rule)
+			if err != nil {
+				t.Fatalf("Error parsing rule: %s", err)
+			}
+
+			violations := CheckLayers(pg, []LayerRule{rule})
+			if len(violations) != len(tc.expected) {
+				t.Fatalf("Expected %d violations, got %v", len(tc.expected), violations)
+			}
+			for i, v := range violations {
+				if v.String() != tc.expected[i] {
+					t.Errorf("Expected violation %q, got %q", tc.expected[i], v)
+				}
+			}
+		})
+	}
+
+	if _, err := ParseLayerRule("internal/db imports internal/http"); err == nil {
+		t.Errorf("Expected an error for an invalid rule")
+	}
+}
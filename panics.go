@@ -0,0 +1,216 @@
+package astro
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+	"unicode"
+)
+
+// knownPanics lists the library functions known to panic.
+var knownPanics = map[string]bool{
+	"log.Panic":   true,
+	"log.Panicf":  true,
+	"log.Panicln": true,
+}
+
+// knownExits lists the library functions exiting the program, which no recover can stop.
+var knownExits = map[string]bool{
+	"log.Fatal":   true,
+	"log.Fatalf":  true,
+	"log.Fatalln": true,
+	"os.Exit":     true,
+}
+
+// panics reports whether the function called through fun, whose node is callee, is the
+// panic builtin or a function known to panic or to exit; see exits. Besides knownPanics,
+// functions named Must or MustXxx, such as regexp.MustCompile, are expected to panic on
+// failure.
+func (e *extractor) panics(fun ast.Expr, callee *Node) bool {
+	if ident, ok := fun.(*ast.Ident); ok && ident.Name == "panic" {
+		_, declared := e.funcs[ident.Name]
+		return ident.Obj == nil && !declared
+	}
+
+	name := callee.Name[strings.LastIndex(callee.Name, "/")+1:]
+	if knownPanics[name] || exits(callee) {
+		return true
+	}
+
+	name = name[strings.LastIndex(name, ".")+1:]
+	rest, ok := strings.CutPrefix(name, "Must")
+	return ok && (rest == "" || unicode.IsUpper([]rune(rest)[0]))
+}
+
+// exits reports whether callee is a function known to exit the program.
+func exits(callee *Node) bool {
+	return knownExits[callee.Name[strings.LastIndex(callee.Name, "/")+1:]]
+}
+
+// deferRecover adds a Recovers edge from the current function to the function deferred
+// by x if it calls recover. Only a literal or a function of the extracted package can
+// be inspected.
+func (e *extractor) deferRecover(x *ast.DeferStmt) {
+	var body *ast.BlockStmt
+	if lit := e.calledLiteral(x.Call.Fun); lit != nil {
+		body = lit.Body
+	} else if ident, ok := x.Call.Fun.(*ast.Ident); ok {
+		if decl, ok := e.funcs[ident.Name]; ok && (ident.Obj == nil || ident.Obj.Kind == ast.Fun) {
+			body = decl.Body
+		}
+	}
+	if body == nil || !callsRecover(body) {
+		return
+	}
+
+	deferred, _, err := e.callee(x.Call.Fun)
+	if err != nil {
+		return
+	}
+	edge := e.graph.AddEdge(e.currentFunc, deferred, Recovers)
+	edge.SetAttr("pos", e.fset.Position(x.Pos()).String())
+}
+
+// callsRecover reports whether body calls recover itself. A recover called by a nested
+// function literal does not stop a panic.
+func callsRecover(body *ast.BlockStmt) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.CallExpr:
+			if ident, ok := x.Fun.(*ast.Ident); ok && ident.Name == "recover" && ident.Obj == nil {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// PanicPath is a call chain from main to a function that panics.
+type PanicPath struct {
+	Nodes []*Node // functions from main to the panicking one
+	Panic *Edge   // Panics edge of the last function
+}
+
+func (p *PanicPath) String() string {
+	names := make([]string, len(p.Nodes))
+	for i, node := range p.Nodes {
+		names[i] = node.Name
+	}
+	return fmt.Sprintf("%s panics at %s (%s)", strings.Join(names, " -> "), p.Panic.Attr("pos"), p.Panic.To.Name)
+}
+
+// UnrecoveredPanics lists the call chains from main to a panic without an intervening recover.
+//
+// Chains follow the Call, Defers and Spawns edges of the graph from the main function of
+// the main packages. A function with a Recovers edge recovers the panics of its own body
+// and of the functions it calls, but not of the goroutines they spawn, and no function
+// recovers from the calls exiting the program, whose Panics edges have the "exit"
+// attribute. The shortest chain is reported for every Panics edge reached.
+func UnrecoveredPanics(graph *Graph) []*PanicPath {
+	type call struct {
+		from *Node
+		pos  string
+	}
+	adjacency := make(map[*Node][]*Edge)
+	panics := make(map[*Node][]*Edge)
+	recovering := make(map[*Node]bool)
+	spawned := make(map[call]bool)
+	for _, edge := range graph.Edges {
+		switch edge.Relation {
+		case Call, Defers, Spawns:
+			adjacency[edge.From] = append(adjacency[edge.From], edge)
+			if edge.Relation == Spawns {
+				spawned[call{edge.From, edge.Attr("pos")}] = true
+			}
+		case Panics:
+			panics[edge.From] = append(panics[edge.From], edge)
+		case Recovers:
+			recovering[edge.From] = true
+		}
+	}
+
+	// a recover up the chain stops neither an exit nor the panic of a spawned goroutine
+	unrecoverable := func(edge *Edge) bool {
+		return edge.Attr("exit") == "true" || spawned[call{edge.From, edge.Attr("pos")}]
+	}
+
+	// a function is visited at most twice: with and without a recover up the chain
+	type state struct {
+		node      *Node
+		recovered bool
+	}
+	parent := make(map[state]*state)
+	var queue []state
+	mains := mainPackages(graph)
+	for _, node := range graph.Nodes {
+		if isMain(node, mains) {
+			s := state{node, recovering[node]}
+			if _, seen := parent[s]; !seen {
+				parent[s] = nil
+				queue = append(queue, s)
+			}
+		}
+	}
+
+	var paths []*PanicPath
+	reported := make(map[*Edge]bool)
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, edge := range panics[current.node] {
+			if reported[edge] || current.recovered && !unrecoverable(edge) {
+				continue
+			}
+			reported[edge] = true
+
+			var nodes []*Node
+			for s := &current; s != nil; s = parent[*s] {
+				nodes = append([]*Node{s.node}, nodes...)
+			}
+			paths = append(paths, &PanicPath{Nodes: nodes, Panic: edge})
+		}
+
+		for _, edge := range adjacency[current.node] {
+			next := state{edge.To, current.recovered && edge.Relation != Spawns || recovering[edge.To]}
+			if _, seen := parent[next]; seen {
+				continue
+			}
+			from := current
+			parent[next] = &from
+			queue = append(queue, next)
+		}
+	}
+
+	return paths
+}
+
+// mainPackages returns the names of the Package nodes of the main packages of graph.
+// Packages extracted from a directory are named after their import path and record
+// their name in the "name" attribute.
+func mainPackages(graph *Graph) map[string]bool {
+	mains := make(map[string]bool)
+	for _, node := range graph.Nodes {
+		if node.Type != Package {
+			continue
+		}
+		if name := node.Attr("name"); name == "main" || name == "" && node.Name == "main" {
+			mains[node.Name] = true
+		}
+	}
+	return mains
+}
+
+// isMain reports whether node is the main function of one of the main packages, named
+// like any qualification of the function main, but not a method named main.
+func isMain(node *Node, mains map[string]bool) bool {
+	pkg := node.Attr("pkg")
+	if node.Type != Func || !mains[pkg] {
+		return false
+	}
+	return node.Name == "main" || node.Name == "main.main" || node.Name == pkg+".main"
+}
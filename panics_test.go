@@ -0,0 +1,245 @@
+package astro
+
+import (
+	"testing"
+)
+
+func TestExtractGraphFromAST_Panics(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+
+import (
+	"log"
+	"regexp"
+)
+
+func main() {
+	defer cleanup()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println(r)
+		}
+	}()
+	pattern := regexp.MustCompile("a+")
+	if pattern == nil {
+		panic("no pattern")
+	}
+	log.Fatal("done")
+}
+
+func cleanup() {}
+
+func mustard() {}
+`
+
+	graph, err := ExtractGraphFromAST(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	got := relationEdges(graph, Defers, Panics, Recovers)
+	expected := []string{
+		"(main)-[:Defers]->(cleanup)",
+		"(main)-[:Defers]->(main.func@11:8)",
+		"(main)-[:Panics]->(log.Fatal)",
+		"(main)-[:Panics]->(panic)",
+		"(main)-[:Panics]->(regexp.MustCompile)",
+		"(main)-[:Recovers]->(main.func@11:8)",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected edges %v, got %v", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("Expected edge %s, got %s", expected[i], got[i])
+		}
+	}
+
+	// only the calls exiting the program are marked as exits
+	for _, edge := range graph.Edges {
+		if edge.Relation == Panics && (edge.Attr("exit") == "true") != (edge.To.Name == "log.Fatal") {
+			t.Errorf("Expected only the exit of log.Fatal to be marked, got %s with exit %q", edge, edge.Attr("exit"))
+		}
+	}
+
+	// calls known to panic remain calls
+	calls := make(map[string]bool)
+	for _, edge := range relationEdges(graph, Call) {
+		calls[edge] = true
+	}
+	for _, edge := range []string{"(main)-[:Call]->(log.Fatal)", "(main)-[:Call]->(panic)", "(main)-[:Call]->(regexp.MustCompile)"} {
+		if !calls[edge] {
+			t.Errorf("Expected edge %s", edge)
+		}
+	}
+}
+
+func TestUnrecoveredPanics(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+
+func main() {
+	safe()
+	run()
+}
+
+func safe() {
+	defer recoverAll()
+	parse()
+}
+
+func recoverAll() {
+	recover()
+}
+
+func run() {
+	go parse()
+	check()
+}
+
+func check() {
+	parse()
+}
+
+func parse() {
+	panic("invalid input")
+}
+`
+
+	graph, err := ExtractGraphFromAST(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	if recovers := relationEdges(graph, Recovers); len(recovers) != 1 || recovers[0] != "(safe)-[:Recovers]->(recoverAll)" {
+		t.Fatalf("Expected safe to recover through recoverAll, got %v", recovers)
+	}
+
+	paths := UnrecoveredPanics(graph)
+	if len(paths) != 1 {
+		t.Fatalf("Expected 1 path, got %v", paths)
+	}
+
+	// the goroutine spawned by run is the shortest unrecovered chain, since the panic
+	// of parse is recovered when called by safe
+	expected := "main -> run -> parse panics at 28:2 (panic)"
+	if paths[0].String() != expected {
+		t.Errorf("Expected %q, got %q", expected, paths[0])
+	}
+}
+
+func TestUnrecoveredPanics_Exits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		src      string
+		expected []string
+	}{
+		{
+			name: "exit under a recover",
+			src: `
+package main
+import "os"
+func main() {
+	defer func() { recover() }()
+	os.Exit(1)
+}`,
+			expected: []string{"main panics at 6:2 (os.Exit)"},
+		},
+		{
+			name: "deferred panic",
+			src: `
+package main
+func main() {
+	cleanup()
+}
+func cleanup() {
+	defer panic("cleanup")
+}`,
+			expected: []string{"main -> cleanup panics at 7:8 (panic)"},
+		},
+		{
+			name: "spawned exit and panic under a recover",
+			src: `
+package main
+import "log"
+func main() {
+	defer func() { recover() }()
+	serve()
+}
+func serve() {
+	go log.Fatal("serve")
+	go panic("serve")
+}`,
+			expected: []string{
+				"main -> serve panics at 9:5 (log.Fatal)",
+				"main -> serve panics at 10:5 (panic)",
+			},
+		},
+		{
+			name: "method named main",
+			src: `
+package main
+type server struct{}
+func (server) main() {
+	panic("server")
+}
+func main() {}`,
+			expected: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			graph, err := ExtractGraphFromAST(tc.src)
+			if err != nil {
+				t.Fatalf("Error extracting graph: %s", err)
+			}
+
+			paths := UnrecoveredPanics(graph)
+			if len(paths) != len(tc.expected) {
+				t.Fatalf("Expected paths %v, got %v", tc.expected, paths)
+			}
+			for i, path := range paths {
+				if path.String() != tc.expected[i] {
+					t.Errorf("Expected %q, got %q", tc.expected[i], path)
+				}
+			}
+		})
+	}
+}
+
+func TestUnrecoveredPanics_MainPackage(t *testing.T) {
+	t.Parallel()
+
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.21\n",
+		"main.go": `package main
+
+func main() {
+	panic("app")
+}
+`,
+		"tool/tool.go": `package tool
+
+func main() {
+	panic("tool")
+}
+`,
+	})
+
+	graph, err := ExtractGraphFromDir(root)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	paths := UnrecoveredPanics(graph)
+	if len(paths) != 1 || paths[0].Nodes[0].Name != "example.com/app.main" {
+		t.Errorf("Expected a single path from example.com/app.main, got %v", paths)
+	}
+}
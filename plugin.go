@@ -0,0 +1,104 @@
+package astro
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// Plugin extracts domain-specific nodes and edges, such as HTTP routes or SQL queries,
+// alongside the builder.
+//
+// The builder calls Visit for every node of the syntax tree, in the order of ast.Inspect,
+// once it extracted the node itself. Package-level declarations are visited before the
+// function declarations of a package. Plugins declare their own node types and relations,
+// which are plain strings:
+//
+//	const Route astro.NodeType = "Route"
+type Plugin interface {
+	Visit(ctx *VisitContext, n ast.Node)
+}
+
+// PluginFunc adapts a function to the Plugin interface.
+type PluginFunc func(ctx *VisitContext, n ast.Node)
+
+func (f PluginFunc) Visit(ctx *VisitContext, n ast.Node) {
+	f(ctx, n)
+}
+
+// VisitContext gives a plugin access to the extraction state around the visited node.
+type VisitContext struct {
+	Graph   *Graph
+	Fset    *token.FileSet
+	File    *ast.File
+	Package *Node       // package being extracted
+	Func    *Node       // enclosing function or function literal, or the package outside of functions
+	Info    *types.Info // type information, possibly partial
+
+	e *extractor
+}
+
+// pluginNodeKey identifies a node created by a plugin.
+type pluginNodeKey struct {
+	t    NodeType
+	name string
+}
+
+// Node returns the node of type t with the given name, creating it on its first request.
+// Nodes created by plugins are kept out of the node map, like variables.
+func (ctx *VisitContext) Node(t NodeType, name string) *Node {
+	key := pluginNodeKey{t, name}
+	if node, exists := ctx.e.pluginNodes[key]; exists {
+		return node
+	}
+
+	node := NewNode(t, name)
+	ctx.Graph.Nodes = append(ctx.Graph.Nodes, node)
+	ctx.e.pluginNodes[key] = node
+
+	return node
+}
+
+// AddEdge adds an edge with the given relation, recording pos in its "pos" attribute.
+func (ctx *VisitContext) AddEdge(from, to *Node, r Relation, pos token.Pos) *Edge {
+	edge := ctx.Graph.AddEdge(from, to, r)
+	edge.SetAttr("pos", ctx.Position(pos))
+	return edge
+}
+
+// Position formats pos like the "pos" attributes of the graph.
+func (ctx *VisitContext) Position(pos token.Pos) string {
+	return ctx.Fset.Position(pos).String()
+}
+
+// Resolve returns the function node expr refers to, named as if expr were called, such
+// as the node of a handler passed to a registration function.
+func (ctx *VisitContext) Resolve(expr ast.Expr) (*Node, error) {
+	node, _, err := ctx.e.callee(expr)
+	return node, err
+}
+
+// Diagnose records a diagnostic of the plugin in the graph.
+func (ctx *VisitContext) Diagnose(pos token.Pos, severity Severity, kind DiagnosticKind, message string) {
+	ctx.e.diagnose(pos, severity, kind, "%s", message)
+}
+
+// runPlugins calls the plugins of the extraction on n.
+func (e *extractor) runPlugins(n ast.Node) {
+	if len(e.plugins) == 0 {
+		return
+	}
+
+	ctx := &VisitContext{
+		Graph:   e.graph,
+		Fset:    e.fset,
+		File:    e.file,
+		Package: e.pkgNode,
+		Func:    e.currentFunc,
+		Info:    e.info,
+		e:       e,
+	}
+	for _, plugin := range e.plugins {
+		plugin.Visit(ctx, n)
+	}
+}
@@ -0,0 +1,64 @@
+package astro
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func TestPlugin(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+
+import "os"
+
+var debug = os.Getenv("DEBUG")
+
+func main() {
+	start := func() {
+		os.Getenv("HOME")
+	}
+	start()
+}
+`
+
+	const Env NodeType = "EnvironmentVariable"
+	const ReadsEnv Relation = "ReadsEnv"
+
+	// a plugin linking functions to the environment variables they read
+	env := PluginFunc(func(ctx *VisitContext, n ast.Node) {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 {
+			return
+		}
+		callee, err := ctx.Resolve(call.Fun)
+		if err != nil || callee.Name != "os.Getenv" {
+			return
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok {
+			return
+		}
+		ctx.AddEdge(ctx.Func, ctx.Node(Env, lit.Value), ReadsEnv, call.Pos())
+	})
+
+	graph, err := NewBuilder(WithPlugins(env)).Extract(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	got := relationEdges(graph, ReadsEnv)
+	expected := []string{`(main)-[:ReadsEnv]->("DEBUG")`, `(main.func@9:11)-[:ReadsEnv]->("HOME")`}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected edges %v, got %v", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("Expected edge %s, got %s", expected[i], got[i])
+		}
+	}
+	if countNodeType(graph, Env) != 2 {
+		t.Errorf("Expected 2 environment variable nodes, got %d", countNodeType(graph, Env))
+	}
+}
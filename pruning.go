@@ -8,6 +8,14 @@ package astro
 //
 // ref: https://artint.info/3e/html/ArtInt3e.Ch3.S7.html $3.7.2
 func MultiPathPruning(graph *Graph, startNode *Node, goal func(n *Node) bool) ([]*Node, bool) {
+	return MultiPathPruningFunc(graph, startNode, goal, nil)
+}
+
+// MultiPathPruningFunc performs the same search as MultiPathPruning, but only follows the edges
+// for which follow returns true. A nil follow function follows every edge.
+//
+// It allows restricting a search to some relations, e.g. to data-flow edges only.
+func MultiPathPruningFunc(graph *Graph, startNode *Node, goal func(n *Node) bool, follow func(e *Edge) bool) ([]*Node, bool) {
 	frontier, explored, visited := initialize(startNode)
 
 	for len(frontier) > 0 {
@@ -17,7 +25,7 @@ func MultiPathPruning(graph *Graph, startNode *Node, goal func(n *Node) bool) ([
 			return path, true
 		}
 
-		updateFrontier(graph, node, path, &frontier, visited)
+		updateFrontier(graph, node, path, &frontier, visited, follow)
 	}
 
 	return nil, false
@@ -43,9 +51,12 @@ func exploreNode(frontier *[][]*Node, visited map[*Node]bool) ([]*Node, *Node) {
 	return path, node
 }
 
-func updateFrontier(graph *Graph, node *Node, path []*Node, frontier *[][]*Node, visited map[*Node][]*Node) {
+func updateFrontier(graph *Graph, node *Node, path []*Node, frontier *[][]*Node, visited map[*Node][]*Node, follow func(e *Edge) bool) {
 	for _, edge := range graph.Edges {
-		if edge.From == node && !contains(path, edge.To) {
+		if edge.From != node || (follow != nil && !follow(edge)) {
+			continue
+		}
+		if !contains(path, edge.To) {
 			newPath := append([]*Node(nil), path...)
 			newPath = append(newPath, edge.To)
 
@@ -212,3 +212,45 @@ func TestDetectCycle(t *testing.T) {
 		}
 	}
 }
+
+func TestMultiPathPruningFunc(t *testing.T) {
+	t.Parallel()
+
+	nodeA := &Node{Type: "TypeA", Name: "A"}
+	nodeB := &Node{Type: "TypeB", Name: "B"}
+	nodeC := &Node{Type: "TypeC", Name: "C"}
+
+	graph := &Graph{
+		Nodes: []*Node{nodeA, nodeB, nodeC},
+		Edges: []*Edge{
+			{From: nodeA, To: nodeC, Relation: Uses},
+			{From: nodeA, To: nodeB, Relation: Call},
+			{From: nodeB, To: nodeC, Relation: Call},
+		},
+	}
+
+	goal := func(n *Node) bool {
+		return n == nodeC
+	}
+
+	// without a filter the shortest path uses the Uses edge
+	path, found := MultiPathPruningFunc(graph, nodeA, goal, nil)
+	if !found || !reflect.DeepEqual(path, []*Node{nodeA, nodeC}) {
+		t.Errorf("Expected path A -> C, got %v", path)
+	}
+
+	onlyCalls := func(e *Edge) bool {
+		return e.Relation == Call
+	}
+	path, found = MultiPathPruningFunc(graph, nodeA, goal, onlyCalls)
+	if !found || !reflect.DeepEqual(path, []*Node{nodeA, nodeB, nodeC}) {
+		t.Errorf("Expected path A -> B -> C, got %v", path)
+	}
+
+	noEdges := func(e *Edge) bool {
+		return false
+	}
+	if _, found := MultiPathPruningFunc(graph, nodeA, goal, noEdges); found {
+		t.Errorf("Expected no path when no edge can be followed")
+	}
+}
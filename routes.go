@@ -0,0 +1,231 @@
+package astro
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// Node type and relation extracted by RoutePlugin.
+const (
+	Route   NodeType = "Route"
+	Handles Relation = "Handles"
+)
+
+// routeMethods maps the registration methods of routers named after an HTTP method, as
+// in chi (r.Get) or gin and echo (r.GET), to that method.
+var routeMethods = map[string]string{
+	"Get":     "GET",
+	"Head":    "HEAD",
+	"Post":    "POST",
+	"Put":     "PUT",
+	"Patch":   "PATCH",
+	"Delete":  "DELETE",
+	"Connect": "CONNECT",
+	"Options": "OPTIONS",
+	"Trace":   "TRACE",
+}
+
+// RoutePlugin is a plugin extracting the HTTP routes served by handlers.
+//
+// Every registration of a handler adds a Route node, linked to the handler by a Handles
+// edge, so that the call paths from a route can be followed through the graph. Routes
+// are registered with:
+//
+//   - http.Handle and http.HandleFunc, and the methods of the same name of a ServeMux
+//   - the Handle and HandleFunc methods of other routers, such as gorilla/mux and chi
+//   - the methods of routers named after an HTTP method, such as r.Get or r.POST
+//
+// Patterns are parsed like the patterns of Go 1.22, "[METHOD ][HOST]/[PATH]". The route
+// is named after its method and pattern, e.g. "GET /users/{id}", and its "method",
+// "host" and "path" attributes are set, "method" being ANY for routes matching every
+// method. Handlers wrapped by a middleware, such as http.StripPrefix or a conversion to
+// http.HandlerFunc, are followed to the handlers they wrap; handlers built by a function
+// call resolve to that function.
+type RoutePlugin struct{}
+
+func (RoutePlugin) Visit(ctx *VisitContext, n ast.Node) {
+	call, ok := n.(*ast.CallExpr)
+	if !ok || len(call.Args) != 2 {
+		return
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return
+	}
+
+	lit, ok := call.Args[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return
+	}
+	pattern, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return
+	}
+
+	method := "ANY"
+	switch {
+	case sel.Sel.Name == "Handle" || sel.Sel.Name == "HandleFunc":
+		if isHTTPPackage(ctx, sel.X) {
+			break
+		}
+		if t := knownType(ctx, sel.X); t != nil && !isServeMux(t) && !isHandlerValue(ctx, call.Args[1]) {
+			return
+		}
+	case routeMethod(sel.Sel.Name) != "":
+		if isHTTPPackage(ctx, sel.X) || !strings.HasPrefix(pattern, "/") {
+			return // e.g. http.Get, or a key-value store
+		}
+		if !isHandlerValue(ctx, call.Args[1]) {
+			return
+		}
+		method = routeMethod(sel.Sel.Name)
+	default:
+		return
+	}
+
+	if i := strings.IndexAny(pattern, " \t"); i >= 0 {
+		method = pattern[:i]
+		pattern = strings.TrimLeft(pattern[i:], " \t")
+	}
+	host, path := "", pattern
+	if i := strings.Index(pattern, "/"); i > 0 {
+		host, path = pattern[:i], pattern[i:]
+	}
+
+	name := pattern
+	if method != "ANY" {
+		name = method + " " + pattern
+	}
+	route := ctx.Node(Route, name)
+	if route.Attr("pos") == "" {
+		route.SetAttr("pos", ctx.Position(call.Pos()))
+		route.SetAttr("method", method)
+		route.SetAttr("path", path)
+		if host != "" {
+			route.SetAttr("host", host)
+		}
+	}
+
+	for _, handler := range handlers(ctx, call.Args[1]) {
+		ctx.AddEdge(route, handler, Handles, call.Args[1].Pos())
+	}
+}
+
+// routeMethod returns the HTTP method a registration method is named after, if any.
+func routeMethod(name string) string {
+	if method, ok := routeMethods[name]; ok {
+		return method
+	}
+	for _, method := range routeMethods {
+		if name == method {
+			return method
+		}
+	}
+	return ""
+}
+
+// handlers returns the nodes of the functions handling the requests served by expr.
+func handlers(ctx *VisitContext, expr ast.Expr) []*Node {
+	switch x := expr.(type) {
+	case *ast.ParenExpr:
+		return handlers(ctx, x.X)
+	case *ast.UnaryExpr:
+		if x.Op == token.AND {
+			return handlers(ctx, x.X)
+		}
+	case *ast.CallExpr:
+		if isHandlerFunc(ctx, x.Fun) && len(x.Args) == 1 {
+			return handlers(ctx, x.Args[0]) // conversion
+		}
+
+		// middlewares lead to the handlers they wrap, and factories to themselves
+		var wrapped []*Node
+		for _, arg := range x.Args {
+			if knownType(ctx, arg) != nil && isHandlerValue(ctx, arg) {
+				wrapped = append(wrapped, handlers(ctx, arg)...)
+			}
+		}
+		if len(wrapped) > 0 {
+			return wrapped
+		}
+		if factory, err := ctx.Resolve(x.Fun); err == nil {
+			return []*Node{factory}
+		}
+		return nil
+	}
+
+	// values of a type of the package serve requests with its ServeHTTP method
+	if t := knownType(ctx, expr); t != nil {
+		if _, isFunc := t.Underlying().(*types.Signature); !isFunc {
+			if serve := serveHTTP(t); serve != nil && serve.Pkg() != nil && ctx.e.isExtracted(serve.Pkg()) {
+				if name := ctx.e.methodName(serve); name != "" {
+					return []*Node{ctx.e.funcNode(name)}
+				}
+			}
+			return nil
+		}
+	}
+
+	if handler, err := ctx.Resolve(expr); err == nil {
+		return []*Node{handler}
+	}
+	return nil
+}
+
+// knownType returns the type of expr, or nil if it could not be inferred.
+func knownType(ctx *VisitContext, expr ast.Expr) types.Type {
+	tv, ok := ctx.Info.Types[expr]
+	if !ok || tv.Type == nil || tv.Type == types.Typ[types.Invalid] {
+		return nil
+	}
+	return tv.Type
+}
+
+// isHTTPPackage reports whether expr refers to the net/http package.
+func isHTTPPackage(ctx *VisitContext, expr ast.Expr) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Obj == nil && ctx.e.imports[ident.Name] == "net/http"
+}
+
+// isHandlerFunc reports whether fun is the http.HandlerFunc type.
+func isHandlerFunc(ctx *VisitContext, fun ast.Expr) bool {
+	sel, ok := fun.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == "HandlerFunc" && isHTTPPackage(ctx, sel.X)
+}
+
+// isServeMux reports whether t is an http.ServeMux or a pointer to one.
+func isServeMux(t types.Type) bool {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := t.(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "net/http" && named.Obj().Name() == "ServeMux"
+}
+
+// isHandlerValue reports whether expr is a function or a value with a ServeHTTP method.
+// Values whose type is not known are assumed to be handlers.
+func isHandlerValue(ctx *VisitContext, expr ast.Expr) bool {
+	t := knownType(ctx, expr)
+	if t == nil {
+		return true
+	}
+	if _, isFunc := t.Underlying().(*types.Signature); isFunc {
+		return true
+	}
+	return serveHTTP(t) != nil
+}
+
+// serveHTTP returns the ServeHTTP method of t or of a pointer to t, if any.
+func serveHTTP(t types.Type) *types.Func {
+	if _, isPtr := t.(*types.Pointer); !isPtr {
+		if _, isIface := t.Underlying().(*types.Interface); !isIface {
+			t = types.NewPointer(t)
+		}
+	}
+	obj, _, _ := types.LookupFieldOrMethod(t, true, nil, "ServeHTTP")
+	fn, _ := obj.(*types.Func)
+	return fn
+}
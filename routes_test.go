@@ -0,0 +1,105 @@
+package astro
+
+import (
+	"testing"
+)
+
+func TestRoutePlugin(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type api struct{}
+
+func (a *api) ServeHTTP(w http.ResponseWriter, r *http.Request) {}
+
+func index(w http.ResponseWriter, r *http.Request) {
+	render(w)
+}
+
+func render(w http.ResponseWriter) {}
+
+func getUser(w http.ResponseWriter, r *http.Request) {}
+
+func logging(next http.Handler) http.Handler {
+	return next
+}
+
+func static(dir string) http.HandlerFunc {
+	return nil
+}
+
+func main() {
+	http.HandleFunc("/", index)
+	http.Handle("/api/", &api{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", getUser)
+	mux.Handle("POST example.com/users", logging(http.HandlerFunc(getUser)))
+	mux.Handle("/static/", http.StripPrefix("/static/", static("assets")))
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
+
+	r := chi.NewRouter()
+	r.Get("/orders", index)
+	r.Post("/orders", getUser)
+
+	cache := map[string]string{}
+	_ = cache
+	http.Get("/not/a/route")
+}
+`
+
+	graph, err := NewBuilder(WithPlugins(RoutePlugin{})).Extract(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	got := relationEdges(graph, Handles)
+	expected := []string{
+		"(/)-[:Handles]->(index)",
+		"(/api/)-[:Handles]->(api.ServeHTTP)",
+		"(/health)-[:Handles]->(main.func@38:28)",
+		"(/static/)-[:Handles]->(static)",
+		"(GET /orders)-[:Handles]->(index)",
+		"(GET /users/{id})-[:Handles]->(getUser)",
+		"(POST /orders)-[:Handles]->(getUser)",
+		"(POST example.com/users)-[:Handles]->(getUser)",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected edges %v, got %v", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("Expected edge %s, got %s", expected[i], got[i])
+		}
+	}
+
+	route := findNode(graph, Route, "POST example.com/users")
+	if route == nil {
+		t.Fatalf("Expected a route for POST example.com/users")
+	}
+	attrs := map[string]string{"method": "POST", "host": "example.com", "path": "/users"}
+	for key, value := range attrs {
+		if route.Attr(key) != value {
+			t.Errorf("Expected %s %q, got %q", key, value, route.Attr(key))
+		}
+	}
+	if any := findNode(graph, Route, "/"); any == nil || any.Attr("method") != "ANY" {
+		t.Errorf("Expected / to match any method, got %v", any)
+	}
+
+	// the calls made by a handler can be followed from its route
+	calls := reachable(graph, findNode(graph, Route, "/"), func(e *Edge) bool {
+		return e.Relation == Handles || e.Relation == Call
+	})
+	if !calls.nodes[graph.NodeMap["render"]] {
+		t.Errorf("Expected render to be reachable from /, got %v", calls.order)
+	}
+}
@@ -0,0 +1,100 @@
+package astro
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// Node type and relation extracted by SQLPlugin.
+const (
+	SQLQuery      NodeType = "SQLQuery"
+	ExecutesQuery Relation = "ExecutesQuery"
+)
+
+// sqlMethods maps the query methods of database/sql to the index of their query argument.
+var sqlMethods = map[string]int{
+	"Exec":            0,
+	"ExecContext":     1,
+	"Query":           0,
+	"QueryContext":    1,
+	"QueryRow":        0,
+	"QueryRowContext": 1,
+	"Prepare":         0,
+	"PrepareContext":  1,
+}
+
+// SQLPlugin is an example plugin extracting the SQL queries run by functions.
+//
+// Every call of a query method of a database/sql DB, Tx or Conn adds an ExecutesQuery edge
+// from the calling function to a SQLQuery node named after the query, with whitespace runs
+// collapsed. Queries built at run time are named after their expression and marked with
+// a "dynamic" attribute. Without type information, only calls passing a literal query
+// are taken as queries.
+type SQLPlugin struct{}
+
+func (SQLPlugin) Visit(ctx *VisitContext, n ast.Node) {
+	call, ok := n.(*ast.CallExpr)
+	if !ok {
+		return
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return
+	}
+	index, ok := sqlMethods[sel.Sel.Name]
+	if !ok || index >= len(call.Args) {
+		return
+	}
+
+	arg := call.Args[index]
+	lit, isLiteral := arg.(*ast.BasicLit)
+	isLiteral = isLiteral && lit.Kind == token.STRING
+
+	if tv, ok := ctx.Info.Types[sel.X]; ok && tv.Type != nil && tv.Type != types.Typ[types.Invalid] {
+		if !isSQLHandle(tv.Type) {
+			return
+		}
+	} else if !isLiteral {
+		return
+	}
+
+	name := types.ExprString(arg)
+	dynamic := true
+	if isLiteral {
+		if query, err := strconv.Unquote(lit.Value); err == nil {
+			name = strings.Join(strings.Fields(query), " ")
+			dynamic = false
+		}
+	}
+
+	query := ctx.Node(SQLQuery, name)
+	if query.Attr("pos") == "" {
+		query.SetAttr("pos", ctx.Position(arg.Pos()))
+	}
+	if dynamic {
+		query.SetAttr("dynamic", "true")
+	}
+
+	edge := ctx.AddEdge(ctx.Func, query, ExecutesQuery, call.Pos())
+	edge.SetAttr("method", sel.Sel.Name)
+}
+
+// isSQLHandle reports whether t is a DB, Tx or Conn of database/sql, or a pointer to one.
+func isSQLHandle(t types.Type) bool {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil || named.Obj().Pkg().Path() != "database/sql" {
+		return false
+	}
+
+	switch named.Obj().Name() {
+	case "DB", "Tx", "Conn":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package astro
+
+import (
+	"testing"
+)
+
+func TestSQLPlugin(t *testing.T) {
+	t.Parallel()
+
+	src := `
+package main
+
+import (
+	"context"
+	"database/sql"
+)
+
+type store struct{ db *sql.DB }
+
+func (s *store) user(ctx context.Context, id int) {
+	s.db.QueryRowContext(ctx, "SELECT name\n\t\tFROM users WHERE id = ?", id)
+}
+
+func (s *store) delete(table string) {
+	tx, _ := s.db.Begin()
+	tx.Exec("DELETE FROM " + table)
+	tx.Commit()
+}
+
+type cache struct{}
+
+func (cache) Exec(key string) {}
+
+func main() {
+	var c cache
+	c.Exec("not a query")
+}
+`
+
+	graph, err := NewBuilder(WithPlugins(SQLPlugin{})).Extract(src)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	got := relationEdges(graph, ExecutesQuery)
+	expected := []string{
+		`(store.delete)-[:ExecutesQuery]->("DELETE FROM " + table)`,
+		"(store.user)-[:ExecutesQuery]->(SELECT name FROM users WHERE id = ?)",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected edges %v, got %v", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("Expected edge %s, got %s", expected[i], got[i])
+		}
+	}
+
+	if dynamic := findNode(graph, SQLQuery, `"DELETE FROM " + table`); dynamic == nil || dynamic.Attr("dynamic") != "true" {
+		t.Errorf("Expected the concatenated query to be dynamic, got %v", dynamic)
+	}
+}
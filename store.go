@@ -0,0 +1,872 @@
+package astro
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A store keeps graphs on disk in two append-only logs of records:
+//
+//	graph.log      node, edge, lookup, table and index records of every snapshot
+//	snapshots.log  snapshot records, naming the commit and the index of every snapshot
+//
+// Every record is framed by its length and CRC-32 checksum. Saving a snapshot appends
+// its nodes, its edges, its lookup records and its tables to the graph log, then its
+// index, and commits it by appending its snapshot record to the snapshot log, so that a
+// save interrupted by a crash leaves unreferenced records behind but no partial snapshot.
+//
+// Nodes and edges are identified by their position in the snapshot, and every node
+// record holds the edges from and to the node. A table lists the offsets of records as
+// fixed-size entries, so that any entry is read on its own: the tables of a snapshot list
+// its nodes and edges by position, and its lookup records of the nodes of every name and
+// type sorted by key, to be binary searched. The index of a snapshot only locates its
+// tables, so that opening a snapshot reads neither its nodes nor its names.
+
+const (
+	storeGraphLog    = "graph.log"
+	storeSnapshotLog = "snapshots.log"
+)
+
+// Kinds of the records of a store.
+const (
+	recordNode byte = iota + 1
+	recordEdge
+	recordIndex
+	recordSnapshot
+	recordLookup
+	recordTable
+)
+
+// Flags of node records.
+const (
+	nodeListed byte = 1 << iota // node of the node list of the graph
+	nodeMapped                  // node of the node map of the graph
+)
+
+// recordHeaderSize is the size of the length and checksum framing every record.
+const recordHeaderSize = 8
+
+// tableEntrySize is the size of the entries of table records, following their kind.
+const tableEntrySize = 8
+
+// ErrNoSnapshot is returned when opening a snapshot missing from a store.
+var ErrNoSnapshot = errors.New("no snapshot of commit")
+
+// Store is an embedded store of graphs on disk, keeping a snapshot of the graph of every
+// commit saved. Snapshots are loaded lazily: nodes and edges are read from disk as they
+// are queried. A Store is safe for concurrent use.
+type Store struct {
+	mu        sync.Mutex
+	graphs    *os.File
+	size      int64 // size of the graph log
+	snapshots *os.File
+	entries   []snapshotEntry // last snapshot of every commit, in saving order
+}
+
+type snapshotEntry struct {
+	commit string
+	index  int64 // offset of the index record in the graph log
+	saved  time.Time
+}
+
+// OpenStore opens the store in the directory dir, creating it if needed.
+func OpenStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating store: %s", err)
+	}
+
+	graphs, err := os.OpenFile(filepath.Join(dir, storeGraphLog), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening store: %s", err)
+	}
+	info, err := graphs.Stat()
+	if err != nil {
+		graphs.Close()
+		return nil, fmt.Errorf("error opening store: %s", err)
+	}
+	snapshots, err := os.OpenFile(filepath.Join(dir, storeSnapshotLog), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		graphs.Close()
+		return nil, fmt.Errorf("error opening store: %s", err)
+	}
+
+	s := &Store{graphs: graphs, size: info.Size(), snapshots: snapshots}
+	if err := s.readSnapshots(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// readSnapshots reads the snapshot log, dropping the last record if a crash left it
+// incomplete. Any other corrupted record fails, since the snapshots after it would be
+// lost.
+func (s *Store) readSnapshots() error {
+	var offset int64
+	for {
+		payload, err := readRecord(s.snapshots, offset)
+		if err == io.EOF {
+			return nil
+		}
+		if errors.Is(err, errIncompleteRecord) {
+			// only the last record can run past the end of the log
+			if err := s.snapshots.Truncate(offset); err != nil {
+				return fmt.Errorf("error repairing snapshot log: %s", err)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading snapshot log: %s", err)
+		}
+		d := decoder{buf: payload}
+		if d.getByte() != recordSnapshot {
+			return fmt.Errorf("error reading snapshot log: unexpected record at %d", offset)
+		}
+		offset += recordHeaderSize + int64(len(payload))
+
+		entry := snapshotEntry{commit: d.getString(), index: int64(d.getUint()), saved: time.Unix(0, d.getInt())}
+		if d.err != nil {
+			return fmt.Errorf("error reading snapshot log: %s", d.err)
+		}
+		s.addEntry(entry)
+	}
+}
+
+// addEntry records the snapshot of a commit, replacing any previous one.
+func (s *Store) addEntry(entry snapshotEntry) {
+	for i, e := range s.entries {
+		if e.commit == entry.commit {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			break
+		}
+	}
+	s.entries = append(s.entries, entry)
+}
+
+// Close closes the files of the store. The snapshots opened from it can no longer be
+// queried.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.Join(s.graphs.Close(), s.snapshots.Close())
+}
+
+// Commits returns the commits of the snapshots of the store, in the order they were
+// last saved.
+func (s *Store) Commits() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	commits := make([]string, len(s.entries))
+	for i, e := range s.entries {
+		commits[i] = e.commit
+	}
+	return commits
+}
+
+// Save saves graph as the snapshot of commit, which can be any key naming a version of
+// the graph, such as a commit hash. Saving a commit again replaces its snapshot; the
+// records of the previous one are left in the log.
+func (s *Store) Save(commit string, graph *Graph) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// nodes referred to by edges only are saved too, off the node list
+	ids := make(map[*Node]int)
+	var nodes []*Node
+	for _, node := range graph.Nodes {
+		if _, exists := ids[node]; !exists {
+			ids[node] = len(nodes)
+			nodes = append(nodes, node)
+		}
+	}
+	listed := len(nodes)
+	for _, edge := range graph.Edges {
+		for _, node := range []*Node{edge.From, edge.To} {
+			if _, exists := ids[node]; !exists {
+				ids[node] = len(nodes)
+				nodes = append(nodes, node)
+			}
+		}
+	}
+	out := make([][]int, len(nodes))
+	in := make([][]int, len(nodes))
+	for i, edge := range graph.Edges {
+		from, to := ids[edge.From], ids[edge.To]
+		out[from] = append(out[from], i)
+		in[to] = append(in[to], i)
+	}
+
+	w := &recordWriter{w: bufio.NewWriter(s.graphs), offset: s.size}
+	nodeOffsets := make([]int64, len(nodes))
+	for i, node := range nodes {
+		var flags byte
+		if i < listed {
+			flags |= nodeListed
+		}
+		if graph.NodeMap[node.Name] == node {
+			flags |= nodeMapped
+		}
+
+		var e encoder
+		e.putByte(recordNode)
+		e.putByte(flags)
+		e.putString(string(node.Type))
+		e.putString(node.Name)
+		e.putAttrs(node.Attrs)
+		e.putInts(out[i])
+		e.putInts(in[i])
+		nodeOffsets[i] = w.write(e.buf)
+	}
+
+	edgeOffsets := make([]int64, len(graph.Edges))
+	for i, edge := range graph.Edges {
+		var e encoder
+		e.putByte(recordEdge)
+		e.putUint(uint64(ids[edge.From]))
+		e.putUint(uint64(ids[edge.To]))
+		e.putString(string(edge.Relation))
+		e.putAttrs(edge.Attrs)
+		edgeOffsets[i] = w.write(e.buf)
+	}
+
+	byName := make(map[string][]int)
+	byType := make(map[string][]int)
+	for i, node := range nodes {
+		byName[node.Name] = append(byName[node.Name], i)
+		byType[string(node.Type)] = append(byType[string(node.Type)], i)
+	}
+
+	tables := []table{
+		w.writeTable(nodeOffsets),
+		w.writeTable(edgeOffsets),
+		w.writeLookup(byName),
+		w.writeLookup(byType),
+	}
+
+	var e encoder
+	e.putByte(recordIndex)
+	e.putString(commit)
+	for _, t := range tables {
+		e.putUint(uint64(t.offset))
+		e.putUint(uint64(t.len))
+	}
+	e.putUint(uint64(len(graph.Diagnostics)))
+	for _, d := range graph.Diagnostics {
+		e.putString(d.Pos)
+		e.putInt(int64(d.Severity))
+		e.putString(string(d.Kind))
+		e.putString(d.Message)
+	}
+	index := w.write(e.buf)
+
+	err := w.flush()
+	if err == nil {
+		err = s.graphs.Sync()
+	}
+	if err != nil {
+		// the records written are left unreferenced, past the size of the log
+		if info, statErr := s.graphs.Stat(); statErr == nil {
+			s.size = info.Size()
+		}
+		return fmt.Errorf("error saving graph: %s", err)
+	}
+	s.size = w.offset
+
+	entry := snapshotEntry{commit: commit, index: index, saved: time.Now()}
+	e = encoder{}
+	e.putByte(recordSnapshot)
+	e.putString(entry.commit)
+	e.putUint(uint64(entry.index))
+	e.putInt(entry.saved.UnixNano())
+	info, err := s.snapshots.Stat()
+	if err != nil {
+		return fmt.Errorf("error saving snapshot: %s", err)
+	}
+	_, err = s.snapshots.Write(frame(e.buf))
+	if err == nil {
+		err = s.snapshots.Sync()
+	}
+	if err != nil {
+		// a partial record followed by the next one would make the log unreadable
+		if truncErr := s.snapshots.Truncate(info.Size()); truncErr != nil {
+			err = errors.Join(err, truncErr)
+		}
+		return fmt.Errorf("error saving snapshot: %s", err)
+	}
+	s.addEntry(entry)
+
+	return nil
+}
+
+// Snapshot opens the snapshot of commit, reading its index only.
+func (s *Store) Snapshot(commit string) (*Snapshot, error) {
+	s.mu.Lock()
+	var entry snapshotEntry
+	var found bool
+	for _, e := range s.entries {
+		if e.commit == commit {
+			entry, found = e, true
+			break
+		}
+	}
+	s.mu.Unlock()
+	if !found {
+		return nil, fmt.Errorf("%w %s", ErrNoSnapshot, commit)
+	}
+
+	payload, err := readRecord(s.graphs, entry.index)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot %s: %s", commit, err)
+	}
+	d := decoder{buf: payload}
+	if d.getByte() != recordIndex || d.getString() != commit {
+		return nil, fmt.Errorf("error reading snapshot %s: unexpected record at %d", commit, entry.index)
+	}
+
+	sn := &Snapshot{
+		store:  s,
+		commit: commit,
+		saved:  entry.saved,
+		nodes:  make(map[int]*Node),
+		ids:    make(map[*Node]int),
+		flags:  make(map[int]byte),
+		out:    make(map[int][]int),
+		in:     make(map[int][]int),
+		edges:  make(map[int]*Edge),
+	}
+	for _, t := range []*table{&sn.nodeTable, &sn.edgeTable, &sn.names, &sn.types} {
+		t.offset, t.len = int64(d.getUint()), int(d.getUint())
+		if d.err != nil {
+			break
+		}
+		if err := t.check(s.graphs); err != nil {
+			return nil, fmt.Errorf("error reading snapshot %s: %s", commit, err)
+		}
+	}
+	n := d.getUint()
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		sn.diagnostics = append(sn.diagnostics, Diagnostic{
+			Pos:      d.getString(),
+			Severity: Severity(d.getInt()),
+			Kind:     DiagnosticKind(d.getString()),
+			Message:  d.getString(),
+		})
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("error reading snapshot %s: %s", commit, d.err)
+	}
+
+	return sn, nil
+}
+
+// Snapshot is the graph of a commit saved in a store, whose nodes and edges are read from
+// disk on their first query. The same node is returned by every query of a snapshot.
+type Snapshot struct {
+	store  *Store
+	commit string
+	saved  time.Time
+
+	nodeTable   table // node records by position
+	edgeTable   table // edge records by position
+	names       table // lookup records of the nodes of every name, sorted by name
+	types       table // lookup records of the nodes of every type, sorted by type
+	diagnostics []Diagnostic
+
+	mu      sync.Mutex // guards the nodes and edges read
+	nodes   map[int]*Node
+	ids     map[*Node]int
+	flags   map[int]byte
+	out, in map[int][]int // edges from and to the nodes read
+	edges   map[int]*Edge
+}
+
+// Commit returns the commit of the snapshot.
+func (sn *Snapshot) Commit() string {
+	return sn.commit
+}
+
+// Saved returns the time the snapshot was saved.
+func (sn *Snapshot) Saved() time.Time {
+	return sn.saved
+}
+
+// Diagnostics returns the diagnostics of the graph of the snapshot.
+func (sn *Snapshot) Diagnostics() []Diagnostic {
+	return sn.diagnostics
+}
+
+// Lookup returns the nodes named name, in the order of the graph.
+func (sn *Snapshot) Lookup(name string) ([]*Node, error) {
+	return sn.nodeList(sn.names, name)
+}
+
+// NodesOfType returns the nodes of type t, in the order of the graph.
+func (sn *Snapshot) NodesOfType(t NodeType) ([]*Node, error) {
+	return sn.nodeList(sn.types, string(t))
+}
+
+// Out returns the edges from n, a node of the snapshot, in the order of the graph.
+func (sn *Snapshot) Out(n *Node) ([]*Edge, error) {
+	return sn.neighbors(n, sn.out)
+}
+
+// In returns the edges to n, a node of the snapshot, in the order of the graph.
+func (sn *Snapshot) In(n *Node) ([]*Edge, error) {
+	return sn.neighbors(n, sn.in)
+}
+
+func (sn *Snapshot) neighbors(n *Node, edges map[int][]int) ([]*Edge, error) {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	id, ok := sn.ids[n]
+	if !ok {
+		return nil, fmt.Errorf("node %s is not a node of snapshot %s", n, sn.commit)
+	}
+	result := make([]*Edge, len(edges[id]))
+	for i, edge := range edges[id] {
+		e, err := sn.edge(edge)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = e
+	}
+	return result, nil
+}
+
+// Graph loads the whole graph of the snapshot.
+func (sn *Snapshot) Graph() (*Graph, error) {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	graph := NewGraph()
+	for id := 0; id < sn.nodeTable.len; id++ {
+		node, err := sn.node(id)
+		if err != nil {
+			return nil, err
+		}
+		if sn.flags[id]&nodeListed != 0 {
+			graph.Nodes = append(graph.Nodes, node)
+		}
+		if sn.flags[id]&nodeMapped != 0 {
+			graph.NodeMap[node.Name] = node
+		}
+	}
+	for id := 0; id < sn.edgeTable.len; id++ {
+		edge, err := sn.edge(id)
+		if err != nil {
+			return nil, err
+		}
+		graph.Edges = append(graph.Edges, edge)
+	}
+	graph.Diagnostics = append(graph.Diagnostics, sn.diagnostics...)
+
+	return graph, nil
+}
+
+// nodeList returns the nodes of the lookup record of key in t, if any.
+func (sn *Snapshot) nodeList(t table, key string) ([]*Node, error) {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	ids, err := sn.lookup(t, key)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]*Node, len(ids))
+	for i, id := range ids {
+		node, err := sn.node(id)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = node
+	}
+	return nodes, nil
+}
+
+// lookup returns the ids of the lookup record of key, binary searching the table t.
+func (sn *Snapshot) lookup(t table, key string) ([]int, error) {
+	lo, hi := 0, t.len
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		offset, err := t.entry(sn.store.graphs, mid)
+		if err != nil {
+			return nil, fmt.Errorf("error reading snapshot %s: %s", sn.commit, err)
+		}
+		d, err := sn.record(recordLookup, offset)
+		if err != nil {
+			return nil, err
+		}
+		k, ids := d.getString(), d.getInts()
+		if d.err != nil {
+			return nil, fmt.Errorf("error reading snapshot %s: %s", sn.commit, d.err)
+		}
+
+		switch {
+		case k == key:
+			return ids, nil
+		case k < key:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+	return nil, nil
+}
+
+// record returns a decoder of the payload of the record at offset, following its kind.
+func (sn *Snapshot) record(kind byte, offset int64) (*decoder, error) {
+	payload, err := readRecord(sn.store.graphs, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot %s: %s", sn.commit, err)
+	}
+	d := &decoder{buf: payload}
+	if d.getByte() != kind {
+		return nil, fmt.Errorf("error reading snapshot %s: unexpected record at %d", sn.commit, offset)
+	}
+	return d, nil
+}
+
+// node returns the node with the given id, reading it on its first use.
+func (sn *Snapshot) node(id int) (*Node, error) {
+	if node, exists := sn.nodes[id]; exists {
+		return node, nil
+	}
+
+	offset, err := sn.nodeTable.entry(sn.store.graphs, id)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot %s: %s", sn.commit, err)
+	}
+	d, err := sn.record(recordNode, offset)
+	if err != nil {
+		return nil, err
+	}
+	flags := d.getByte()
+	node := NewNode(NodeType(d.getString()), d.getString())
+	node.Attrs = d.getAttrs()
+	out, in := d.getInts(), d.getInts()
+	if d.err != nil {
+		return nil, fmt.Errorf("error reading snapshot %s: %s", sn.commit, d.err)
+	}
+
+	sn.nodes[id] = node
+	sn.ids[node] = id
+	sn.flags[id] = flags
+	sn.out[id], sn.in[id] = out, in
+	return node, nil
+}
+
+// edge returns the edge with the given id, reading it and its nodes on their first use.
+func (sn *Snapshot) edge(id int) (*Edge, error) {
+	if edge, exists := sn.edges[id]; exists {
+		return edge, nil
+	}
+
+	offset, err := sn.edgeTable.entry(sn.store.graphs, id)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot %s: %s", sn.commit, err)
+	}
+	d, err := sn.record(recordEdge, offset)
+	if err != nil {
+		return nil, err
+	}
+	from, to := int(d.getUint()), int(d.getUint())
+	relation := Relation(d.getString())
+	attrs := d.getAttrs()
+	if d.err != nil {
+		return nil, fmt.Errorf("error reading snapshot %s: %s", sn.commit, d.err)
+	}
+
+	fromNode, err := sn.node(from)
+	if err != nil {
+		return nil, err
+	}
+	toNode, err := sn.node(to)
+	if err != nil {
+		return nil, err
+	}
+	edge := NewEdge(fromNode, toNode, relation)
+	edge.Attrs = attrs
+
+	sn.edges[id] = edge
+	return edge, nil
+}
+
+// frame returns payload framed by its length and checksum.
+func frame(payload []byte) []byte {
+	record := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	return append(record, payload...)
+}
+
+var errIncompleteRecord = errors.New("incomplete record")
+
+// readRecord returns the payload of the record at offset of f. It returns io.EOF at the
+// end of f, an error wrapping errIncompleteRecord if the record runs past the end of f,
+// and an error if it is corrupted. The length of the record is checked against the size
+// of f before its payload is allocated.
+func readRecord(f *os.File, offset int64) ([]byte, error) {
+	var header [recordHeaderSize]byte
+	n, err := f.ReadAt(header[:], offset)
+	if err == io.EOF && n == 0 {
+		return nil, io.EOF
+	}
+	if n < recordHeaderSize {
+		return nil, recordError(offset, err)
+	}
+
+	length := int64(binary.LittleEndian.Uint32(header[0:4]))
+	info, err := f.Stat()
+	if err != nil {
+		return nil, recordError(offset, err)
+	}
+	if offset+recordHeaderSize+length > info.Size() {
+		return nil, recordError(offset, io.EOF)
+	}
+	payload := make([]byte, length)
+	if _, err := f.ReadAt(payload, offset+recordHeaderSize); err != nil {
+		return nil, recordError(offset, err)
+	}
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:8]) {
+		return nil, fmt.Errorf("corrupted record at %d", offset)
+	}
+	return payload, nil
+}
+
+// recordError returns the error of a record read short at offset because of err.
+func recordError(offset int64, err error) error {
+	if err == io.EOF {
+		return fmt.Errorf("%w at %d", errIncompleteRecord, offset)
+	}
+	return fmt.Errorf("error reading record at %d: %s", offset, err)
+}
+
+// table locates a table record, listing the offsets of len records.
+type table struct {
+	offset int64
+	len    int
+}
+
+// check checks that the table record of f holds len entries, reading its header only.
+func (t table) check(f *os.File) error {
+	var header [recordHeaderSize + 1]byte
+	if _, err := f.ReadAt(header[:], t.offset); err != nil {
+		return recordError(t.offset, err)
+	}
+	if header[recordHeaderSize] != recordTable || int64(binary.LittleEndian.Uint32(header[0:4])) != 1+tableEntrySize*int64(t.len) {
+		return fmt.Errorf("unexpected record at %d", t.offset)
+	}
+	return nil
+}
+
+// entry returns the offset listed by the entry i of the table, reading it on its own.
+// Entries are not checked against the checksum of the table, which would require
+// reading it whole.
+func (t table) entry(f *os.File, i int) (int64, error) {
+	if i < 0 || i >= t.len {
+		return 0, fmt.Errorf("no entry %d in table at %d", i, t.offset)
+	}
+	var entry [tableEntrySize]byte
+	if _, err := f.ReadAt(entry[:], t.offset+recordHeaderSize+1+tableEntrySize*int64(i)); err != nil {
+		return 0, recordError(t.offset, err)
+	}
+	return int64(binary.LittleEndian.Uint64(entry[:])), nil
+}
+
+// recordWriter writes framed records, tracking their offset.
+type recordWriter struct {
+	w      *bufio.Writer
+	offset int64
+	err    error
+}
+
+// write writes a record with the given payload and returns its offset.
+func (w *recordWriter) write(payload []byte) int64 {
+	offset := w.offset
+	record := frame(payload)
+	if w.err == nil {
+		_, w.err = w.w.Write(record)
+	}
+	w.offset += int64(len(record))
+	return offset
+}
+
+// writeTable writes a table record listing offsets and returns its location.
+func (w *recordWriter) writeTable(offsets []int64) table {
+	var e encoder
+	e.putByte(recordTable)
+	for _, v := range offsets {
+		e.buf = binary.LittleEndian.AppendUint64(e.buf, uint64(v))
+	}
+	return table{offset: w.write(e.buf), len: len(offsets)}
+}
+
+// writeLookup writes a lookup record for every key of index, then the table of their
+// offsets sorted by key, and returns its location.
+func (w *recordWriter) writeLookup(index map[string][]int) table {
+	keys := make([]string, 0, len(index))
+	for k := range index {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	offsets := make([]int64, len(keys))
+	for i, k := range keys {
+		var e encoder
+		e.putByte(recordLookup)
+		e.putString(k)
+		e.putInts(index[k])
+		offsets[i] = w.write(e.buf)
+	}
+	return w.writeTable(offsets)
+}
+
+func (w *recordWriter) flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+// encoder encodes the payload of records.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) putByte(b byte) {
+	e.buf = append(e.buf, b)
+}
+
+func (e *encoder) putUint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *encoder) putInt(v int64) {
+	e.buf = binary.AppendVarint(e.buf, v)
+}
+
+func (e *encoder) putString(s string) {
+	e.putUint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// putAttrs encodes attributes sorted by key, so that saving a graph is deterministic.
+func (e *encoder) putAttrs(attrs map[string]string) {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	e.putUint(uint64(len(keys)))
+	for _, k := range keys {
+		e.putString(k)
+		e.putString(attrs[k])
+	}
+}
+
+func (e *encoder) putInts(list []int) {
+	e.putUint(uint64(len(list)))
+	for _, v := range list {
+		e.putUint(uint64(v))
+	}
+}
+
+// decoder decodes the payload of records. Decoding stops at the first error, recorded
+// in err, after which zero values are returned.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+var errTruncatedRecord = errors.New("truncated record")
+
+func (d *decoder) getByte() byte {
+	if d.err != nil || len(d.buf) == 0 {
+		d.fail()
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) getUint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) getInt() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) getString() string {
+	n := d.getUint()
+	if d.err != nil || n > uint64(len(d.buf)) {
+		d.fail()
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+func (d *decoder) getAttrs() map[string]string {
+	n := d.getUint()
+	if n == 0 || d.err != nil {
+		return nil
+	}
+	attrs := make(map[string]string)
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		k := d.getString()
+		attrs[k] = d.getString()
+	}
+	return attrs
+}
+
+func (d *decoder) getInts() []int {
+	n := d.getUint()
+	if n > uint64(len(d.buf)) {
+		d.fail()
+		return nil
+	}
+	list := make([]int, n)
+	for i := range list {
+		list[i] = int(d.getUint())
+	}
+	return list
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = errTruncatedRecord
+	}
+}
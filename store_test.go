@@ -0,0 +1,326 @@
+package astro
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	graph, err := ExtractGraphFromDir(writeTree(t, layeredModule))
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+	graph.Diagnostics = append(graph.Diagnostics, Diagnostic{Pos: "main.go:1:1", Severity: SeverityWarning, Kind: DiagnosticSkipped, Message: "skipped"})
+
+	dir := t.TempDir()
+	store, err := OpenStore(dir)
+	if err != nil {
+		t.Fatalf("Error opening store: %s", err)
+	}
+	if err := store.Save("c1", graph); err != nil {
+		t.Fatalf("Error saving graph: %s", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Error closing store: %s", err)
+	}
+
+	store, err = OpenStore(dir)
+	if err != nil {
+		t.Fatalf("Error reopening store: %s", err)
+	}
+	defer store.Close()
+
+	sn, err := store.Snapshot("c1")
+	if err != nil {
+		t.Fatalf("Error opening snapshot: %s", err)
+	}
+
+	// queries only read the nodes and edges they return
+	opens, err := sn.Lookup("example.com/app/internal/db.Open")
+	if err != nil {
+		t.Fatalf("Error looking up node: %s", err)
+	}
+	if len(opens) != 1 || opens[0].Type != Func || opens[0].Attr("pkg") != "example.com/app/internal/db" {
+		t.Fatalf("Expected the node of db.Open, got %v", opens)
+	}
+	out, err := sn.Out(opens[0])
+	if err != nil {
+		t.Fatalf("Error reading edges: %s", err)
+	}
+	if len(out) != 1 || out[0].String() != "(example.com/app/internal/db.Open)-[:Call]->(example.com/app/internal/http.Serve)" {
+		t.Errorf("Expected db.Open to call http.Serve, got %v", out)
+	}
+	in, err := sn.In(opens[0])
+	if err != nil {
+		t.Fatalf("Error reading edges: %s", err)
+	}
+	var calls int
+	for _, edge := range in {
+		if edge.Relation == Call {
+			calls++
+		}
+	}
+	if calls != 3 {
+		t.Errorf("Expected db.Open to be called 3 times, got %v", in)
+	}
+	if len(sn.nodes) >= len(graph.Nodes) || len(sn.edges) != len(out)+len(in) {
+		t.Errorf("Expected the snapshot to be loaded lazily, got %d nodes and %d edges read", len(sn.nodes), len(sn.edges))
+	}
+	if again, _ := sn.Lookup("example.com/app/internal/db.Open"); again[0] != opens[0] {
+		t.Errorf("Expected queries to return the same node")
+	}
+	if missing, err := sn.Lookup("example.com/app/internal/db.Missing"); err != nil || len(missing) != 0 {
+		t.Errorf("Expected no node of a missing name, got %v, %v", missing, err)
+	}
+
+	pkgs, err := sn.NodesOfType(Package)
+	if err != nil {
+		t.Fatalf("Error looking up nodes: %s", err)
+	}
+	if len(pkgs) != countNodeType(graph, Package) {
+		t.Errorf("Expected %d packages, got %v", countNodeType(graph, Package), pkgs)
+	}
+
+	if _, err := sn.Out(NewNode(Func, "other")); err == nil {
+		t.Errorf("Expected an error querying a node of another graph")
+	}
+
+	loaded, err := sn.Graph()
+	if err != nil {
+		t.Fatalf("Error loading graph: %s", err)
+	}
+	compareGraphs(t, loaded, graph)
+	if len(loaded.NodeMap) != len(graph.NodeMap) {
+		t.Errorf("Expected %d mapped nodes, got %d", len(graph.NodeMap), len(loaded.NodeMap))
+	}
+	for name := range graph.NodeMap {
+		if loaded.NodeMap[name] == nil {
+			t.Errorf("Expected %s in the node map", name)
+		}
+	}
+}
+
+func TestStore_Snapshots(t *testing.T) {
+	t.Parallel()
+
+	v1, err := ExtractGraphFromAST(diffBefore)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+	v2, err := ExtractGraphFromAST(diffAfter)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	dir := t.TempDir()
+	store, err := OpenStore(dir)
+	if err != nil {
+		t.Fatalf("Error opening store: %s", err)
+	}
+	for _, save := range []struct {
+		commit string
+		graph  *Graph
+	}{{"a1", v1}, {"b2", v2}, {"c3", v1}, {"a1", v2}} {
+		if err := store.Save(save.commit, save.graph); err != nil {
+			t.Fatalf("Error saving %s: %s", save.commit, err)
+		}
+	}
+	store.Close()
+
+	// a crash while saving leaves an incomplete snapshot record
+	f, err := os.OpenFile(filepath.Join(dir, storeSnapshotLog), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{42, 0, 0, 0, 1}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	store, err = OpenStore(dir)
+	if err != nil {
+		t.Fatalf("Error reopening store: %s", err)
+	}
+	defer store.Close()
+	if err := store.Save("d4", v1); err != nil {
+		t.Fatalf("Error saving after a crash: %s", err)
+	}
+
+	expected := []string{"b2", "c3", "a1", "d4"}
+	commits := store.Commits()
+	if len(commits) != len(expected) {
+		t.Fatalf("Expected commits %v, got %v", expected, commits)
+	}
+	for i := range expected {
+		if commits[i] != expected[i] {
+			t.Errorf("Expected commits %v, got %v", expected, commits)
+			break
+		}
+	}
+
+	for commit, graph := range map[string]*Graph{"a1": v2, "b2": v2, "c3": v1, "d4": v1} {
+		sn, err := store.Snapshot(commit)
+		if err != nil {
+			t.Fatalf("Error opening snapshot %s: %s", commit, err)
+		}
+		loaded, err := sn.Graph()
+		if err != nil {
+			t.Fatalf("Error loading snapshot %s: %s", commit, err)
+		}
+		t.Run(commit, func(t *testing.T) {
+			compareGraphs(t, loaded, graph)
+		})
+	}
+
+	if _, err := store.Snapshot("missing"); !errors.Is(err, ErrNoSnapshot) {
+		t.Errorf("Expected ErrNoSnapshot, got %v", err)
+	}
+}
+
+func TestStore_Corruption(t *testing.T) {
+	t.Parallel()
+
+	graph, err := ExtractGraphFromAST(diffBefore)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(log []byte) []byte
+		commits []string // nil if reopening the store fails
+	}{
+		{
+			name: "incomplete last record",
+			corrupt: func(log []byte) []byte {
+				return log[:len(log)-3]
+			},
+			commits: []string{"a1", "b2"},
+		},
+		{
+			name: "incomplete header",
+			corrupt: func(log []byte) []byte {
+				return append(log, 42, 0, 0, 0, 1)
+			},
+			commits: []string{"a1", "b2", "c3"},
+		},
+		{
+			name: "length of the last record past the end",
+			corrupt: func(log []byte) []byte {
+				var last int
+				for next := 0; next < len(log); next += recordHeaderSize + int(binary.LittleEndian.Uint32(log[next:])) {
+					last = next
+				}
+				binary.LittleEndian.PutUint32(log[last:], 0xffffffff)
+				return log
+			},
+			commits: []string{"a1", "b2"},
+		},
+		{
+			name: "corrupted record in the middle",
+			corrupt: func(log []byte) []byte {
+				log[recordHeaderSize+2] ^= 0xff
+				return log
+			},
+		},
+		{
+			name: "corrupted last record",
+			corrupt: func(log []byte) []byte {
+				log[len(log)-1] ^= 0xff
+				return log
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			store, err := OpenStore(dir)
+			if err != nil {
+				t.Fatalf("Error opening store: %s", err)
+			}
+			for _, commit := range []string{"a1", "b2", "c3"} {
+				if err := store.Save(commit, graph); err != nil {
+					t.Fatalf("Error saving %s: %s", commit, err)
+				}
+			}
+			store.Close()
+
+			path := filepath.Join(dir, storeSnapshotLog)
+			log, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tt.corrupt(log), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			store, err = OpenStore(dir)
+			if tt.commits == nil {
+				if err == nil {
+					store.Close()
+					t.Fatalf("Expected an error reopening the store")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error reopening store: %s", err)
+			}
+			defer store.Close()
+
+			commits := store.Commits()
+			if len(commits) != len(tt.commits) {
+				t.Fatalf("Expected commits %v, got %v", tt.commits, commits)
+			}
+			for i := range commits {
+				if commits[i] != tt.commits[i] {
+					t.Errorf("Expected commits %v, got %v", tt.commits, commits)
+					break
+				}
+			}
+			if err := store.Save("d4", graph); err != nil {
+				t.Fatalf("Error saving after repairing the log: %s", err)
+			}
+			if _, err := store.Snapshot("d4"); err != nil {
+				t.Errorf("Error opening snapshot after repairing the log: %s", err)
+			}
+		})
+	}
+}
+
+func TestReadRecord_Length(t *testing.T) {
+	// not parallel, so that the allocations measured are those of readRecord only
+
+	path := filepath.Join(t.TempDir(), storeSnapshotLog)
+	record := frame([]byte("payload"))
+	binary.LittleEndian.PutUint32(record, 0xffffffff)
+	if err := os.WriteFile(path, record, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err = readRecord(f, 0)
+	runtime.ReadMemStats(&after)
+
+	if !errors.Is(err, errIncompleteRecord) {
+		t.Errorf("Expected an incomplete record, got %v", err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("Expected the payload not to be allocated, got %d bytes allocated", allocated)
+	}
+}
@@ -0,0 +1,188 @@
+package astro
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TaintConfig declares the functions a taint analysis starts from (sources), reports
+// when reached (sinks), and stops at (sanitizers).
+//
+// Functions are written as "pkg.Func" for package-level functions, and as
+// "pkg.Type.Method" for methods. Since call nodes are named after the receiver
+// expression (e.g. "r.FormValue"), methods are matched by the receiver type recorded on
+// the edges calling them, either Type or *Type. When no receiver type is known, such as
+// when the package of the receiver could not be imported, methods match any call of a
+// method with the same name.
+//
+// A configuration file is a JSON document such as:
+//
+//	{
+//		"sources": ["os.Getenv", "http.Request.FormValue"],
+//		"sinks": ["exec.Command", "sql.DB.Query"],
+//		"sanitizers": ["strconv.Atoi"]
+//	}
+type TaintConfig struct {
+	Sources    []string `json:"sources"`
+	Sinks      []string `json:"sinks"`
+	Sanitizers []string `json:"sanitizers"`
+}
+
+// LoadTaintConfig reads a taint configuration from the JSON file at path.
+func LoadTaintConfig(path string) (*TaintConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading taint config: %s", err)
+	}
+
+	return ParseTaintConfig(data)
+}
+
+// ParseTaintConfig parses a taint configuration from its JSON representation.
+func ParseTaintConfig(data []byte) (*TaintConfig, error) {
+	var config TaintConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing taint config: %s", err)
+	}
+
+	if len(config.Sources) == 0 || len(config.Sinks) == 0 {
+		return nil, fmt.Errorf("taint config needs at least one source and one sink")
+	}
+
+	return &config, nil
+}
+
+// TaintPath is a flow of data from a source to a sink.
+type TaintPath struct {
+	Source *Node
+	Sink   *Node
+	Nodes  []*Node
+	Edges  []*Edge // traversed data-flow edges, carrying their position in the "pos" attribute
+}
+
+func (p *TaintPath) String() string {
+	var builder strings.Builder
+	builder.WriteString(p.Source.String())
+	for _, edge := range p.Edges {
+		builder.WriteString(fmt.Sprintf("-[:%s@%s]->%s", edge.Relation, edge.Attr("pos"), edge.To))
+	}
+	return builder.String()
+}
+
+// TaintAnalysis reports the paths through which data produced by a source reaches a sink.
+//
+// The search follows the data-flow edges (Assigns, PassesTo, Return) of the graph using
+// MultiPathPruningFunc, and does not continue past sanitizers. One path is reported for
+// every pair of source and sink connected in the graph.
+func TaintAnalysis(graph *Graph, config *TaintConfig) []*TaintPath {
+	sources := matchingFuncs(graph, config.Sources)
+	sinks := matchingFuncs(graph, config.Sinks)
+	sanitizers := make(map[*Node]bool)
+	for _, node := range matchingFuncs(graph, config.Sanitizers) {
+		sanitizers[node] = true
+	}
+
+	follow := func(e *Edge) bool {
+		return isDataFlow(e.Relation) && !sanitizers[e.From]
+	}
+
+	var paths []*TaintPath
+	for _, source := range sources {
+		for _, sink := range sinks {
+			if source == sink {
+				continue
+			}
+
+			nodes, found := MultiPathPruningFunc(graph, source, func(n *Node) bool {
+				return n == sink
+			}, follow)
+			if !found {
+				continue
+			}
+
+			paths = append(paths, &TaintPath{
+				Source: source,
+				Sink:   sink,
+				Nodes:  nodes,
+				Edges:  pathEdges(graph, nodes, follow),
+			})
+		}
+	}
+
+	return paths
+}
+
+// pathEdges returns the edges accepted by follow connecting consecutive nodes of path.
+func pathEdges(graph *Graph, path []*Node, follow func(e *Edge) bool) []*Edge {
+	var edges []*Edge
+	for i := 0; i+1 < len(path); i++ {
+		for _, edge := range graph.Edges {
+			if edge.From == path[i] && edge.To == path[i+1] && follow(edge) {
+				edges = append(edges, edge)
+				break
+			}
+		}
+	}
+	return edges
+}
+
+// matchingFuncs returns the function nodes of the graph matched by any of the patterns.
+func matchingFuncs(graph *Graph, patterns []string) []*Node {
+	receivers := make(map[*Node][]string)
+	for _, edge := range graph.Edges {
+		if recv := edge.Attr("recv"); recv != "" {
+			receivers[edge.To] = append(receivers[edge.To], recv)
+		}
+	}
+
+	var nodes []*Node
+	for _, node := range graph.Nodes {
+		if node.Type != Func {
+			continue
+		}
+		for _, pattern := range patterns {
+			if matchesCallee(pattern, node.Name, receivers[node]) {
+				nodes = append(nodes, node)
+				break
+			}
+		}
+	}
+	return nodes
+}
+
+// matchesCallee reports whether the callee name, called on receivers of the given types,
+// matches a "pkg.Func" or "pkg.Type.Method" pattern.
+func matchesCallee(pattern, name string, receivers []string) bool {
+	// functions of imported packages are qualified with the full import path
+	// when a whole directory is extracted
+	name = name[strings.LastIndex(name, "/")+1:]
+
+	if pattern == name {
+		return true
+	}
+
+	parts := strings.Split(pattern, ".")
+	if len(parts) < 3 {
+		return false
+	}
+
+	// methods are called through a receiver, so the method name is compared along with
+	// the type of the receiver, if known
+	method := parts[len(parts)-1]
+	if !strings.Contains(name, ".") || !strings.HasSuffix(name, "."+method) {
+		return false
+	}
+	if len(receivers) == 0 {
+		return true
+	}
+	typ := strings.Join(parts[:len(parts)-1], ".")
+	typ = typ[strings.LastIndex(typ, "/")+1:]
+	for _, recv := range receivers {
+		if strings.TrimPrefix(recv, "*") == typ {
+			return true
+		}
+	}
+	return false
+}
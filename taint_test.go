@@ -0,0 +1,180 @@
+package astro
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testTaintConfig = &TaintConfig{
+	Sources:    []string{"os.Getenv", "http.Request.FormValue"},
+	Sinks:      []string{"exec.Command", "sql.DB.Query"},
+	Sanitizers: []string{"strconv.Atoi"},
+}
+
+func TestTaintAnalysis(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		src      string
+		expected []string
+	}{
+		{
+			name: "request value into a command",
+			src: `
+package main
+func handler(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("name")
+	cmd := "ls " + name
+	exec.Command(cmd)
+}`,
+			expected: []string{
+				"(r.FormValue)-[:Assigns@4:10]->(name)-[:Assigns@5:9]->(cmd)-[:PassesTo@6:15]->(exec.Command)",
+			},
+		},
+		{
+			name: "sanitized value",
+			src: `
+package main
+func handler(w http.ResponseWriter, r *http.Request) {
+	n, _ := strconv.Atoi(r.FormValue("n"))
+	db.Query(n)
+}`,
+			expected: nil,
+		},
+		{
+			name: "through a function parameter",
+			src: `
+package main
+func main() {
+	v := os.Getenv("CMD")
+	run(v)
+}
+func run(c string) {
+	exec.Command(c)
+}`,
+			expected: []string{
+				"(os.Getenv)-[:Assigns@4:7]->(v)-[:PassesTo@5:6]->(c)-[:PassesTo@8:15]->(exec.Command)",
+			},
+		},
+		{
+			name: "through a return value",
+			src: `
+package main
+func get() string {
+	return os.Getenv("CMD")
+}
+func main() {
+	s := get()
+	exec.Command(s)
+}`,
+			expected: []string{
+				"(os.Getenv)-[:Return@4:9]->(get)-[:Assigns@7:7]->(s)-[:PassesTo@8:15]->(exec.Command)",
+			},
+		},
+		{
+			name: "methods of other types",
+			src: `
+package main
+import (
+	"database/sql"
+	"net/http"
+)
+type index struct{}
+func (index) Query(q string) {}
+func handler(db *sql.DB, idx index, r *http.Request) {
+	name := r.FormValue("name")
+	idx.Query(name)
+	db.Query(name)
+}`,
+			expected: []string{
+				"(r.FormValue)-[:Assigns@10:10]->(name)-[:PassesTo@12:11]->(db.Query)",
+			},
+		},
+		{
+			name: "no flow between source and sink",
+			src: `
+package main
+func main() {
+	os.Getenv("CMD")
+	exec.Command("ls")
+}`,
+			expected: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			graph, err := ExtractGraphFromAST(tc.src)
+			if err != nil {
+				t.Fatalf("Error extracting graph: %s", err)
+			}
+
+			paths := TaintAnalysis(graph, testTaintConfig)
+			if len(paths) != len(tc.expected) {
+				t.Fatalf("Expected %d taint paths, got %v", len(tc.expected), paths)
+			}
+			for i, path := range paths {
+				if path.String() != tc.expected[i] {
+					t.Errorf("Expected path %s, got %s", tc.expected[i], path)
+				}
+				if len(path.Edges) != len(path.Nodes)-1 {
+					t.Errorf("Expected %d edges, got %d", len(path.Nodes)-1, len(path.Edges))
+				}
+			}
+		})
+	}
+}
+
+func TestLoadTaintConfig(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "taint.json")
+	data := `{"sources": ["os.Getenv"], "sinks": ["exec.Command"], "sanitizers": ["shellescape.Quote"]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadTaintConfig(path)
+	if err != nil {
+		t.Fatalf("Error loading taint config: %s", err)
+	}
+	if len(config.Sources) != 1 || len(config.Sinks) != 1 || len(config.Sanitizers) != 1 {
+		t.Errorf("Unexpected taint config %+v", config)
+	}
+
+	if _, err := ParseTaintConfig([]byte(`{"sources": ["os.Getenv"]}`)); err == nil {
+		t.Errorf("Expected an error for a config without sinks")
+	}
+	if _, err := LoadTaintConfig(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("Expected an error for a missing config file")
+	}
+}
+
+func TestMatchesCallee(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pattern   string
+		name      string
+		receivers []string
+		ok        bool
+	}{
+		{"os.Getenv", "os.Getenv", nil, true},
+		{"os.Getenv", "Getenv", nil, false},
+		{"http.Request.FormValue", "r.FormValue", nil, true},
+		{"http.Request.FormValue", "r.FormValue", []string{"*http.Request"}, true},
+		{"http.Request.FormValue", "r.FormValue", []string{"*multipart.Form"}, false},
+		{"http.Request.FormValue", "FormValue", nil, false},
+		{"sql.DB.Query", "db.QueryRow", nil, false},
+		{"sql.DB.Query", "u.Query", []string{"*url.URL"}, false},
+		{"database/sql.DB.Query", "db.Query", []string{"*sql.DB"}, true},
+	}
+
+	for _, tc := range tests {
+		if got := matchesCallee(tc.pattern, tc.name, tc.receivers); got != tc.ok {
+			t.Errorf("matchesCallee(%q, %q, %v) = %v, expected %v", tc.pattern, tc.name, tc.receivers, got, tc.ok)
+		}
+	}
+}
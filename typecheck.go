@@ -0,0 +1,132 @@
+package astro
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"sync"
+)
+
+// stdImporter imports packages from their export data. It is shared by all extractions
+// so that the export data of a package is only loaded once.
+var stdImporter = &lockedImporter{importer: importer.Default()}
+
+// lockedImporter serializes the imports of an importer, which is not safe for concurrent use.
+type lockedImporter struct {
+	mu       sync.Mutex
+	importer types.Importer
+}
+
+func (l *lockedImporter) Import(path string) (*types.Package, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.importer.Import(path)
+}
+
+// typeChecker type-checks the extracted packages leniently: type errors, including
+// imports that cannot be found, are recorded without stopping the check, and whatever
+// could be inferred is recorded in a single types.Info shared by all packages.
+//
+// Packages of the extracted tree are checked from source when imported by another one,
+// and any other package is imported from its export data.
+type typeChecker struct {
+	fset    *token.FileSet
+	info    *types.Info
+	sources map[string]*parsedPackage
+	checked map[string]*types.Package
+	errors  map[string][]types.Error // type errors by package
+}
+
+func newTypeChecker(fset *token.FileSet, pkgs ...*parsedPackage) *typeChecker {
+	tc := &typeChecker{
+		fset: fset,
+		info: &types.Info{
+			Types:      make(map[ast.Expr]types.TypeAndValue),
+			Defs:       make(map[*ast.Ident]types.Object),
+			Uses:       make(map[*ast.Ident]types.Object),
+			Instances:  make(map[*ast.Ident]types.Instance),
+			Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		},
+		sources: make(map[string]*parsedPackage),
+		checked: make(map[string]*types.Package),
+		errors:  make(map[string][]types.Error),
+	}
+	for _, pkg := range pkgs {
+		tc.sources[pkg.path] = pkg
+	}
+	return tc
+}
+
+// check type-checks the package with the given import path, if it was not already.
+func (tc *typeChecker) check(path string) *types.Package {
+	if pkg, ok := tc.checked[path]; ok {
+		return pkg
+	}
+
+	// mark the package as being checked, so that import cycles end
+	tc.checked[path] = nil
+
+	conf := types.Config{
+		Importer: tc,
+		Error: func(err error) {
+			if typeErr, ok := err.(types.Error); ok {
+				tc.errors[path] = append(tc.errors[path], typeErr)
+			}
+		},
+	}
+	pkg, _ := conf.Check(path, tc.fset, tc.sources[path].files, tc.info)
+	tc.checked[path] = pkg
+
+	return pkg
+}
+
+func (tc *typeChecker) Import(path string) (*types.Package, error) {
+	if _, ok := tc.sources[path]; ok {
+		if pkg := tc.check(path); pkg != nil {
+			return pkg, nil
+		}
+	}
+	return stdImporter.Import(path)
+}
+
+// errorType is the predeclared error interface.
+var errorType = types.Universe.Lookup("error").Type().Underlying().(*types.Interface)
+
+// isError reports whether a value of type t is an error.
+func isError(t types.Type) bool {
+	if t == nil || t == types.Typ[types.Invalid] {
+		return false
+	}
+	return types.Implements(t, errorType)
+}
+
+// typeString formats t with its packages named by their name rather than their path.
+func typeString(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string {
+		return p.Name()
+	})
+}
+
+// forget drops the type information of the package with the given import path, whose
+// files were the given ones, so that the package is checked again on its next import.
+func (tc *typeChecker) forget(path string, files []*ast.File) {
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.Ident:
+				delete(tc.info.Defs, x)
+				delete(tc.info.Uses, x)
+				delete(tc.info.Instances, x)
+			case *ast.SelectorExpr:
+				delete(tc.info.Selections, x)
+			}
+			if expr, ok := n.(ast.Expr); ok {
+				delete(tc.info.Types, expr)
+			}
+			return true
+		})
+	}
+	delete(tc.checked, path)
+	delete(tc.errors, path)
+}
@@ -0,0 +1,47 @@
+package astro
+
+import (
+	"testing"
+)
+
+func TestExtractGraphFromDir_Types(t *testing.T) {
+	t.Parallel()
+
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.21\n",
+		"main.go": `package main
+
+import "example.com/app/store"
+
+func main() {
+	conn, err := store.Open()
+	_ = conn
+	_ = err
+}
+`,
+		"store/store.go": `package store
+
+type Conn struct{}
+
+func Open() (*Conn, error) {
+	return &Conn{}, nil
+}
+`,
+	})
+
+	graph, err := ExtractGraphFromDir(root)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+
+	// the types of a package of the tree are known to the packages importing it
+	conn := findNode(graph, Var, "conn")
+	if conn == nil || conn.Attr("type") != "*store.Conn" {
+		t.Errorf("Expected conn to be a *store.Conn, got %v", conn)
+	}
+
+	flows := ErrorFlows(graph)
+	if len(flows) != 1 || flows[0].Status != ErrorDropped || flows[0].Var != "err" {
+		t.Errorf("Expected the error of store.Open to be dropped, got %v", flows)
+	}
+}
@@ -0,0 +1,379 @@
+package astro
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPollInterval is the interval at which Watch polls the tree of a workspace when
+// file-system notifications are not available.
+const DefaultPollInterval = time.Second
+
+// debounceDelay is how long a watcher waits for more changes once a file changed, so that
+// the files saved together, such as by a refactoring, are applied together.
+const debounceDelay = 50 * time.Millisecond
+
+// Change is the change of the graph of a watched workspace following changed files.
+type Change struct {
+	Files        []string // files whose change caused the update
+	AddedNodes   []*Node
+	RemovedNodes []*Node
+	AddedEdges   []*Edge
+	RemovedEdges []*Edge
+
+	// Err is the error met updating the graph, such as a file that cannot be parsed.
+	// The graph is then left unchanged by that file.
+	Err error
+}
+
+// Empty reports whether the graph is unchanged.
+func (c *Change) Empty() bool {
+	return len(c.AddedNodes) == 0 && len(c.RemovedNodes) == 0 && len(c.AddedEdges) == 0 && len(c.RemovedEdges) == 0
+}
+
+// Watcher keeps the graph of a workspace up to date with the files of its tree, and
+// publishes the changes of the graph to its subscribers.
+type Watcher struct {
+	mu   sync.Mutex // guards the workspace
+	ws   *Workspace
+	subs []chan *Change
+	done chan struct{}
+}
+
+// Watch watches the tree of ws until ctx is done, updating its graph as its files change.
+//
+// On Linux, changes are notified by inotify. Elsewhere, or if inotify cannot be used, the
+// tree is polled every DefaultPollInterval. The workspace must not be used directly while
+// watched; see Watcher.View.
+func Watch(ctx context.Context, ws *Workspace) (*Watcher, error) {
+	w := newWatcher(ws)
+	files := make(chan []string)
+	if err := notify(ctx, ws.root, files); err != nil {
+		if err := poll(ctx, ws.root, DefaultPollInterval, files); err != nil {
+			return nil, err
+		}
+	}
+	go w.run(ctx, files)
+	return w, nil
+}
+
+// WatchPolling watches the tree of ws like Watch, polling it every interval regardless of
+// the notifications of the file system.
+func WatchPolling(ctx context.Context, ws *Workspace, interval time.Duration) (*Watcher, error) {
+	w := newWatcher(ws)
+	files := make(chan []string)
+	if err := poll(ctx, ws.root, interval, files); err != nil {
+		return nil, err
+	}
+	go w.run(ctx, files)
+	return w, nil
+}
+
+func newWatcher(ws *Workspace) *Watcher {
+	return &Watcher{ws: ws, done: make(chan struct{})}
+}
+
+// Subscribe returns a channel receiving the changes of the graph made from now on. A
+// subscriber must keep receiving from the channel, since the watcher waits for every
+// subscriber to receive a change before applying the next one. The channel is closed
+// once the watcher stops.
+func (w *Watcher) Subscribe() <-chan *Change {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	sub := make(chan *Change, 16)
+	select {
+	case <-w.done:
+		close(sub)
+	default:
+		w.subs = append(w.subs, sub)
+	}
+	return sub
+}
+
+// View calls f with the graph of the workspace, which is not updated until f returns.
+func (w *Watcher) View(f func(g *Graph)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	f(w.ws.Graph())
+}
+
+// Done returns a channel closed once the watcher stopped.
+func (w *Watcher) Done() <-chan struct{} {
+	return w.done
+}
+
+// run applies the changed files received from files to the workspace until ctx is done.
+func (w *Watcher) run(ctx context.Context, files <-chan []string) {
+	defer func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		for _, sub := range w.subs {
+			close(sub)
+		}
+		w.subs = nil
+		close(w.done)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case paths := <-files:
+			change := w.apply(paths)
+			if change == nil {
+				continue
+			}
+
+			w.mu.Lock()
+			subs := append([]chan *Change(nil), w.subs...)
+			w.mu.Unlock()
+			for _, sub := range subs {
+				select {
+				case sub <- change:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
+
+// apply updates the workspace with the current content of the given files, and returns
+// the change of its graph, or nil if neither the graph nor the files changed. A directory
+// stands for the files of the workspace under it, such as when it was moved away.
+func (w *Watcher) apply(paths []string) *Change {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var files []string
+	for _, path := range paths {
+		if under := w.ws.filesUnder(path); len(under) > 0 {
+			files = append(files, under...)
+		} else {
+			files = append(files, path)
+		}
+	}
+
+	change := &Change{}
+	var applied []string
+	before := graphElements(w.ws.graph)
+	for _, path := range files {
+		if !w.ws.isExtracted(path) {
+			continue
+		}
+		applied = append(applied, path)
+
+		src, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			err = w.ws.Remove(path)
+		case err == nil:
+			err = w.ws.Update(path, string(src))
+		}
+		var diagnostics *DiagnosticError
+		if err != nil && !errors.As(err, &diagnostics) {
+			change.Err = errors.Join(change.Err, err)
+		}
+	}
+	if len(applied) == 0 {
+		return nil
+	}
+
+	after := graphElements(w.ws.graph)
+	change.Files = applied
+	change.RemovedNodes, change.AddedNodes = diffElements(before.nodes, after.nodes)
+	change.RemovedEdges, change.AddedEdges = diffElements(before.edges, after.edges)
+	if change.Empty() && change.Err == nil {
+		return nil
+	}
+	return change
+}
+
+// elements holds the nodes and edges of a graph by a key describing them, so that the
+// nodes and edges extracted again unchanged are not reported as changes.
+type elements struct {
+	nodes map[string][]*Node
+	edges map[string][]*Edge
+}
+
+func graphElements(g *Graph) elements {
+	el := elements{nodes: make(map[string][]*Node), edges: make(map[string][]*Edge)}
+	for _, node := range g.Nodes {
+		key := nodeKey(node)
+		el.nodes[key] = append(el.nodes[key], node)
+	}
+	for _, edge := range g.Edges {
+		key := nodeKey(edge.From) + "-[:" + string(edge.Relation) + " " + attrsKey(edge.Attrs) + "]->" + nodeKey(edge.To)
+		el.edges[key] = append(el.edges[key], edge)
+	}
+	return el
+}
+
+func nodeKey(n *Node) string {
+	return string(n.Type) + " " + n.Name + " " + attrsKey(n.Attrs)
+}
+
+func attrsKey(attrs map[string]string) string {
+	pairs := make([]string, 0, len(attrs))
+	for k, v := range attrs {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// diffElements returns the elements of before missing from after, and the elements of
+// after missing from before, in the order of their keys.
+func diffElements[T any](before, after map[string][]T) (removed, added []T) {
+	keys := make(map[string]bool)
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	for _, key := range sorted {
+		b, a := before[key], after[key]
+		if len(b) > len(a) {
+			removed = append(removed, b[len(a):]...)
+		}
+		if len(a) > len(b) {
+			added = append(added, a[len(b):]...)
+		}
+	}
+	return removed, added
+}
+
+// poll sends the files of the tree under root that changed, were added or were removed
+// to out, checking the tree every interval until ctx is done. Files are compared by their
+// size and modification time.
+func poll(ctx context.Context, root string, interval time.Duration, out chan<- []string) error {
+	last, err := scanTree(root)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current, err := scanTree(root)
+			if err != nil {
+				continue
+			}
+			var changed []string
+			for path, state := range current {
+				if last[path] != state {
+					changed = append(changed, path)
+				}
+			}
+			for path := range last {
+				if _, exists := current[path]; !exists {
+					changed = append(changed, path)
+				}
+			}
+			last = current
+			if len(changed) == 0 {
+				continue
+			}
+
+			sort.Strings(changed)
+			select {
+			case out <- changed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// fileState is what a poll compares to tell whether a file changed.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// scanTree returns the state of the Go files of the tree under root.
+func scanTree(root string) (map[string]fileState, error) {
+	files := make(map[string]fileState)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && isSkippedDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil // removed meanwhile
+		}
+		files[path] = fileState{info.Size(), info.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+// debounce sends the paths received from in to out in batches, once no path was received
+// for debounceDelay, until ctx is done.
+func debounce(ctx context.Context, in <-chan string, out chan<- []string) {
+	pending := make(map[string]bool)
+	timer := time.NewTimer(debounceDelay)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case path, ok := <-in:
+			if !ok {
+				return
+			}
+			pending[path] = true
+			timer.Reset(debounceDelay)
+		case <-timer.C:
+			batch := make([]string, 0, len(pending))
+			for path := range pending {
+				batch = append(batch, path)
+			}
+			sort.Strings(batch)
+			pending = make(map[string]bool)
+
+			select {
+			case out <- batch:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+//go:build linux
+
+package astro
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask is the set of inotify events watched in every directory of a tree.
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF
+
+// notify sends the files of the tree under root that changed, were added or were removed
+// to out until ctx is done, watching every directory of the tree with inotify. New
+// directories are watched as they are created. A directory moved away is sent as such,
+// since its files are not listed by inotify, and is no longer watched.
+func notify(ctx context.Context, root string, out chan<- []string) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("error initializing inotify: %s", err)
+	}
+	// a non-blocking descriptor is handled by the runtime poller, so that closing the file
+	// unblocks its reads
+	file := os.NewFile(uintptr(fd), "inotify")
+
+	n := &notifier{fd: fd, dirs: make(map[int32]string)}
+	if err := n.addTree(root, nil); err != nil {
+		file.Close()
+		return err
+	}
+
+	paths := make(chan string)
+	go debounce(ctx, paths, out)
+	go func() {
+		<-ctx.Done()
+		file.Close()
+	}()
+	go func() {
+		defer close(paths)
+
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			size, err := file.Read(buf)
+			if err != nil {
+				return
+			}
+			for _, path := range n.events(buf[:size]) {
+				select {
+				case paths <- path:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// notifier tracks the directories watched by an inotify instance.
+type notifier struct {
+	fd   int
+	dirs map[int32]string // directories by watch descriptor
+}
+
+// addTree watches the directory at root and its subdirectories but the skipped ones,
+// appending the Go files found to files, if not nil.
+func (n *notifier) addTree(root string, files *[]string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != root {
+				return nil // removed meanwhile
+			}
+			return err
+		}
+		if !d.IsDir() {
+			if files != nil && strings.HasSuffix(path, ".go") {
+				*files = append(*files, path)
+			}
+			return nil
+		}
+		if path != root && isSkippedDir(d.Name()) {
+			return filepath.SkipDir
+		}
+
+		wd, err := syscall.InotifyAddWatch(n.fd, path, inotifyMask)
+		if err != nil {
+			return fmt.Errorf("error watching %s: %s", path, err)
+		}
+		n.dirs[int32(wd)] = path
+		return nil
+	})
+}
+
+// removeTree stops watching the directory at root and its subdirectories.
+func (n *notifier) removeTree(root string) {
+	prefix := root + string(filepath.Separator)
+	for wd, dir := range n.dirs {
+		if dir == root || strings.HasPrefix(dir, prefix) {
+			syscall.InotifyRmWatch(n.fd, uint32(wd))
+			delete(n.dirs, wd)
+		}
+	}
+}
+
+// events returns the paths of the Go files changed by the inotify events in buf, and of
+// the directories moved away.
+func (n *notifier) events(buf []byte) []string {
+	var paths []string
+	for offset := 0; offset+syscall.SizeofInotifyEvent <= len(buf); {
+		event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		start := offset + syscall.SizeofInotifyEvent
+		end := start + int(event.Len)
+		offset = end
+		if end > len(buf) {
+			break
+		}
+
+		dir, ok := n.dirs[event.Wd]
+		if !ok {
+			continue
+		}
+		if event.Mask&(syscall.IN_DELETE_SELF|syscall.IN_IGNORED) != 0 {
+			delete(n.dirs, event.Wd)
+			continue
+		}
+
+		name := string(bytes.TrimRight(buf[start:end], "\x00"))
+		if name == "" {
+			continue
+		}
+		path := filepath.Join(dir, name)
+
+		if event.Mask&syscall.IN_ISDIR != 0 {
+			switch {
+			case event.Mask&syscall.IN_MOVED_FROM != 0:
+				// the watches of a directory follow it wherever it is moved
+				n.removeTree(path)
+				paths = append(paths, path)
+			case event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 && !isSkippedDir(name):
+				// the files of a directory created or moved in may precede its watch
+				n.addTree(path, &paths)
+			}
+			continue
+		}
+		if strings.HasSuffix(name, ".go") {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package astro
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+// notify is not supported but on Linux, where watchers poll the tree instead.
+func notify(ctx context.Context, root string, out chan<- []string) error {
+	return fmt.Errorf("error watching %s: file-system notifications are not supported on %s", root, runtime.GOOS)
+}
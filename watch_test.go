@@ -0,0 +1,224 @@
+package astro
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+
+	watchers := []struct {
+		name  string
+		watch func(ctx context.Context, ws *Workspace) (*Watcher, error)
+	}{
+		{"notify", Watch},
+		{"poll", func(ctx context.Context, ws *Workspace) (*Watcher, error) {
+			return WatchPolling(ctx, ws, 10*time.Millisecond)
+		}},
+	}
+
+	updates := []struct {
+		name  string
+		path  string
+		src   string // removes the file if empty, unless moved
+		move  string // moves the file or directory there, or out of the tree if "-"
+		added string // node expected among the added nodes
+	}{
+		{
+			name: "modify file",
+			path: "main.go",
+			src: `package main
+
+func main() {
+	helper()
+	check()
+}
+
+func check() {}
+`,
+			added: "example.com/app.check",
+		},
+		{
+			name: "add package",
+			path: "store/store.go",
+			src: `package store
+
+func Open() {}
+`,
+			added: "example.com/app/store.Open",
+		},
+		{
+			name: "use package",
+			path: "util.go",
+			src: `package main
+
+import "example.com/app/store"
+
+func helper() {
+	store.Open()
+}
+`,
+		},
+		{
+			name: "remove file",
+			path: "store/store.go",
+		},
+		{
+			name: "add nested package",
+			path: "lib/inner/inner.go",
+			src: `package inner
+
+func Run() {}
+`,
+			added: "example.com/app/lib/inner.Run",
+		},
+		{
+			name:  "rename directory",
+			path:  "lib",
+			move:  "pkg",
+			added: "example.com/app/pkg/inner.Run",
+		},
+		{
+			name: "modify moved package",
+			path: "pkg/inner/inner.go",
+			src: `package inner
+
+func Run() {}
+
+func Stop() {}
+`,
+			added: "example.com/app/pkg/inner.Stop",
+		},
+		{
+			name: "move directory out",
+			path: "pkg",
+			move: "-",
+		},
+	}
+
+	for _, watcher := range watchers {
+		watcher := watcher
+		t.Run(watcher.name, func(t *testing.T) {
+			t.Parallel()
+
+			root := writeTree(t, map[string]string{
+				"go.mod": "module example.com/app\n\ngo 1.21\n",
+				"main.go": `package main
+
+func main() {
+	helper()
+}
+`,
+				"util.go": `package main
+
+func helper() {}
+`,
+			})
+
+			ws, err := NewWorkspace(root)
+			if err != nil {
+				t.Fatalf("Error creating workspace: %s", err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			w, err := watcher.watch(ctx, ws)
+			if err != nil {
+				t.Fatalf("Error watching workspace: %s", err)
+			}
+			changes := w.Subscribe()
+
+			for _, update := range updates {
+				path := filepath.Join(root, filepath.FromSlash(update.path))
+				switch {
+				case update.move != "":
+					to := filepath.Join(root, filepath.FromSlash(update.move))
+					if update.move == "-" {
+						to = filepath.Join(t.TempDir(), "moved")
+					}
+					if err := os.Rename(path, to); err != nil {
+						t.Fatal(err)
+					}
+				case update.src == "":
+					if err := os.Remove(path); err != nil {
+						t.Fatal(err)
+					}
+				default:
+					if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.WriteFile(path, []byte(update.src), 0o600); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				full, err := ExtractGraphFromDir(root)
+				if err != nil {
+					t.Fatalf("%s: Error extracting graph: %s", update.name, err)
+				}
+				expected := len(graphSignature(full))
+
+				// a change may be seen in several steps, until the graph matches the tree
+				added := make(map[string]bool)
+				for done := false; !done; {
+					select {
+					case change := <-changes:
+						if change.Err != nil {
+							t.Fatalf("%s: Error updating graph: %s", update.name, change.Err)
+						}
+						if len(change.Files) == 0 || change.Empty() {
+							t.Errorf("%s: Expected a change of the graph from a file, got %+v", update.name, change)
+						}
+						for _, node := range change.AddedNodes {
+							added[node.Name] = true
+						}
+						w.View(func(g *Graph) {
+							done = len(graphSignature(g)) == expected
+						})
+					case <-time.After(5 * time.Second):
+						t.Fatalf("%s: Expected a change of the graph, got none", update.name)
+					}
+				}
+
+				t.Run(update.name, func(t *testing.T) {
+					w.View(func(g *Graph) {
+						compareGraphs(t, g, full)
+					})
+					if update.added != "" && !added[update.added] {
+						t.Errorf("Expected %s to be added, got %v", update.added, added)
+					}
+				})
+			}
+
+			cancel()
+			select {
+			case <-w.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatal("Expected the watcher to stop")
+			}
+			if _, open := <-changes; open {
+				t.Error("Expected the changes to be closed")
+			}
+		})
+	}
+}
+
+func TestDiffElements(t *testing.T) {
+	t.Parallel()
+
+	a, b, c := NewNode(Func, "a"), NewNode(Func, "b"), NewNode(Func, "c")
+	b2 := NewNode(Func, "b")
+	before := map[string][]*Node{"a": {a}, "b": {b}}
+	after := map[string][]*Node{"b": {b2}, "c": {c}}
+
+	removed, added := diffElements(before, after)
+	if len(removed) != 1 || removed[0] != a {
+		t.Errorf("Expected a to be removed, got %v", removed)
+	}
+	if len(added) != 1 || added[0] != c {
+		t.Errorf("Expected c to be added, got %v", added)
+	}
+}
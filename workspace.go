@@ -0,0 +1,438 @@
+package astro
+
+import (
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Workspace holds the graph of a directory tree, and keeps it up to date as the files of
+// the tree change without extracting the whole tree again.
+//
+// The workspace records the file every node and edge was extracted from. A file is
+// extracted along with the other files of its package, which share its declarations and
+// its type information, so that a change to a file drops the nodes and edges of its
+// package and extracts the package again. The packages importing it, directly or not,
+// are extracted again too, since their edges into the package depend on its declarations.
+// Nodes shared with the other packages, such as the node of a function they call, are
+// kept as long as an edge of another package refers to them, so that the edges across
+// packages stay connected.
+//
+// The graph of a workspace holds the same nodes and edges as the graph extracted from the
+// tree by ExtractGraphFromDir, possibly in another order. A Workspace is not safe for
+// concurrent use.
+type Workspace struct {
+	root    string
+	modPath string
+	opts    extractOptions
+	fset    *token.FileSet
+	graph   *Graph
+	tc      *typeChecker
+	shared  *sharedNodes
+
+	pkgs     map[string]*parsedPackage // packages by import path
+	filePkgs map[string]string         // import path of the package of every file
+
+	nodeFiles map[*Node]string // file every node was extracted from
+	edgeFiles map[*Edge]string // file every edge was extracted from
+
+	fileDiagnostics map[string][]Diagnostic // diagnostics of the parsing of every file
+	pkgDiagnostics  map[string][]Diagnostic // diagnostics of the extraction of every package
+}
+
+// NewWorkspace extracts the graph of the tree under root like ExtractGraphFromDir.
+func NewWorkspace(root string) (*Workspace, error) {
+	return newWorkspace(root, extractOptions{})
+}
+
+// Workspace extracts the graph of the tree under root into a workspace, with the
+// extraction options of the builder. The filters of the builder do not apply to the
+// graph of a workspace, which holds every node for later updates.
+func (b *Builder) Workspace(root string) (*Workspace, error) {
+	return newWorkspace(root, b.opts)
+}
+
+func newWorkspace(root string, opts extractOptions) (*Workspace, error) {
+	w := &Workspace{
+		root:            root,
+		modPath:         modulePath(root),
+		opts:            opts,
+		fset:            token.NewFileSet(),
+		graph:           NewGraph(),
+		shared:          newSharedNodes(),
+		pkgs:            make(map[string]*parsedPackage),
+		filePkgs:        make(map[string]string),
+		nodeFiles:       make(map[*Node]string),
+		edgeFiles:       make(map[*Edge]string),
+		fileDiagnostics: make(map[string][]Diagnostic),
+		pkgDiagnostics:  make(map[string][]Diagnostic),
+	}
+
+	pkgs, err := parseDir(w.fset, root, opts, func(path string, diagnostics []Diagnostic) {
+		w.fileDiagnostics[path] = diagnostics
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]bool)
+	for _, pkg := range pkgs {
+		w.pkgs[pkg.path] = pkg
+		for _, f := range pkg.files {
+			w.filePkgs[w.fileName(f)] = pkg.path
+		}
+		paths[pkg.path] = true
+	}
+	w.tc = newTypeChecker(w.fset, pkgs...)
+	w.extract(paths)
+
+	return w, checkMode(w.graph, opts.mode)
+}
+
+// Graph returns the graph of the workspace, which is updated in place.
+func (w *Workspace) Graph() *Graph {
+	return w.graph
+}
+
+// Contribution returns the nodes and edges extracted from the file at path.
+func (w *Workspace) Contribution(path string) ([]*Node, []*Edge) {
+	path = w.path(path)
+
+	var nodes []*Node
+	for _, node := range w.graph.Nodes {
+		if w.nodeFiles[node] == path {
+			nodes = append(nodes, node)
+		}
+	}
+	var edges []*Edge
+	for _, edge := range w.graph.Edges {
+		if w.edgeFiles[edge] == path {
+			edges = append(edges, edge)
+		}
+	}
+	return nodes, edges
+}
+
+// Update replaces the source of the file at path, relative to the root of the workspace
+// or absolute, with src, and updates the graph. The file is added if it is new. Files the
+// extraction skips, such as test files unless extracted, are ignored.
+//
+// The graph is left unchanged if the file cannot be parsed. Otherwise, the graph is
+// updated even if its diagnostics then fail the extraction mode, in which case the
+// *DiagnosticError is returned.
+func (w *Workspace) Update(path, src string) error {
+	path = w.path(path)
+	if !w.isExtracted(path) {
+		return nil
+	}
+
+	f, diagnostics, err := parseFile(w.fset, path, []byte(src), w.opts)
+	if err != nil {
+		return err
+	}
+
+	affected := w.removeFile(path)
+	w.fileDiagnostics[path] = diagnostics
+	if f != nil {
+		pkgPath := filePackage(w.modPath, w.root, path, f)
+		pkg, ok := w.pkgs[pkgPath]
+		if !ok {
+			pkg = &parsedPackage{path: pkgPath}
+			w.pkgs[pkgPath] = pkg
+		}
+		pkg.files = append(pkg.files, f)
+		sort.Slice(pkg.files, func(i, j int) bool {
+			return w.fileName(pkg.files[i]) < w.fileName(pkg.files[j])
+		})
+		w.filePkgs[path] = pkgPath
+		affected[pkgPath] = true
+	}
+
+	w.reextract(affected)
+	return checkMode(w.graph, w.opts.mode)
+}
+
+// Remove removes the file at path from the workspace, and updates the graph.
+func (w *Workspace) Remove(path string) error {
+	path = w.path(path)
+	delete(w.fileDiagnostics, path)
+	w.reextract(w.removeFile(path))
+	return checkMode(w.graph, w.opts.mode)
+}
+
+// path returns the path of a file of the workspace, as found by walking its root.
+func (w *Workspace) path(path string) string {
+	if filepath.IsAbs(path) {
+		if rel, err := filepath.Rel(w.root, path); err == nil && !strings.HasPrefix(rel, "..") {
+			path = rel
+		}
+	}
+	return filepath.Join(w.root, path)
+}
+
+// isExtracted reports whether the file at path is extracted when walking the root.
+func (w *Workspace) isExtracted(path string) bool {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	dirs := strings.Split(filepath.ToSlash(filepath.Dir(rel)), "/")
+	for _, dir := range dirs {
+		if dir != "." && isSkippedDir(dir) {
+			return false
+		}
+	}
+	return isSourceFile(filepath.Base(path), w.opts)
+}
+
+// filesUnder returns the files of the workspace under the directory at dir, including
+// the files skipped with a diagnostic, sorted.
+func (w *Workspace) filesUnder(dir string) []string {
+	prefix := dir + string(filepath.Separator)
+	var files []string
+	for path := range w.filePkgs {
+		if strings.HasPrefix(path, prefix) {
+			files = append(files, path)
+		}
+	}
+	for path := range w.fileDiagnostics {
+		if _, parsed := w.filePkgs[path]; !parsed && strings.HasPrefix(path, prefix) {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+func (w *Workspace) fileName(f *ast.File) string {
+	return w.fset.Position(f.Package).Filename
+}
+
+// removeFile removes the file at path from its package, and returns the packages
+// affected by the removal.
+func (w *Workspace) removeFile(path string) map[string]bool {
+	affected := make(map[string]bool)
+	pkgPath, ok := w.filePkgs[path]
+	if !ok {
+		return affected
+	}
+	delete(w.filePkgs, path)
+	affected[pkgPath] = true
+
+	pkg := w.pkgs[pkgPath]
+	for i, f := range pkg.files {
+		if w.fileName(f) == path {
+			// the type information of the file is dropped with its package
+			w.tc.forget(pkgPath, []*ast.File{f})
+			pkg.files = append(pkg.files[:i:i], pkg.files[i+1:]...)
+			break
+		}
+	}
+	return affected
+}
+
+// reextract extracts the given packages and the packages importing them again.
+func (w *Workspace) reextract(changed map[string]bool) {
+	affected := w.dependents(changed)
+
+	// drop the nodes and edges of the affected packages, and of the removed files
+	for path := range affected {
+		if pkg, ok := w.pkgs[path]; ok {
+			w.tc.forget(path, pkg.files)
+		}
+		delete(w.pkgDiagnostics, path)
+	}
+	dropped := make(map[string]bool)
+	markDropped := func(file string) {
+		if pkg, known := w.filePkgs[file]; !known || affected[pkg] {
+			dropped[file] = true
+		}
+	}
+	for _, file := range w.nodeFiles {
+		markDropped(file)
+	}
+	for _, file := range w.edgeFiles {
+		markDropped(file)
+	}
+	w.drop(dropped)
+
+	// packages without files are gone
+	for path := range affected {
+		if pkg, ok := w.pkgs[path]; ok && len(pkg.files) == 0 {
+			delete(w.pkgs, path)
+			delete(affected, path)
+		}
+	}
+	for path := range w.tc.sources {
+		if _, ok := w.pkgs[path]; !ok {
+			delete(w.tc.sources, path)
+		}
+	}
+	for path, pkg := range w.pkgs {
+		w.tc.sources[path] = pkg
+	}
+
+	w.extract(affected)
+}
+
+// dependents returns the given packages, and the packages of the workspace importing
+// them, directly or not.
+func (w *Workspace) dependents(changed map[string]bool) map[string]bool {
+	importers := make(map[string][]string)
+	for path, pkg := range w.pkgs {
+		for _, f := range pkg.files {
+			for _, spec := range f.Imports {
+				imported := strings.Trim(spec.Path.Value, `"`)
+				importers[imported] = append(importers[imported], path)
+			}
+		}
+		// the external test package of a directory imports it
+		if strings.HasSuffix(path, "_test") {
+			importers[strings.TrimSuffix(path, "_test")] = append(importers[strings.TrimSuffix(path, "_test")], path)
+		}
+	}
+
+	affected := make(map[string]bool)
+	var queue []string
+	for path := range changed {
+		affected[path] = true
+		queue = append(queue, path)
+	}
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		for _, importer := range importers[path] {
+			if !affected[importer] {
+				affected[importer] = true
+				queue = append(queue, importer)
+			}
+		}
+	}
+	return affected
+}
+
+// drop removes the nodes and edges extracted from the given files. Nodes still referred
+// to by the edges of other files are kept, and attributed to one of these files.
+func (w *Workspace) drop(files map[string]bool) {
+	var edges []*Edge
+	referrers := make(map[*Node]string)
+	for _, edge := range w.graph.Edges {
+		file := w.edgeFiles[edge]
+		if files[file] {
+			delete(w.edgeFiles, edge)
+			continue
+		}
+		edges = append(edges, edge)
+		for _, node := range []*Node{edge.From, edge.To} {
+			if _, ok := referrers[node]; !ok {
+				referrers[node] = file
+			}
+		}
+	}
+	w.graph.Edges = edges
+
+	removed := make(map[*Node]bool)
+	var nodes []*Node
+	for _, node := range w.graph.Nodes {
+		file := w.nodeFiles[node]
+		if files[file] {
+			referrer, referred := referrers[node]
+			if !referred {
+				removed[node] = true
+				delete(w.nodeFiles, node)
+				if w.graph.NodeMap[node.Name] == node {
+					delete(w.graph.NodeMap, node.Name)
+				}
+				continue
+			}
+			w.nodeFiles[node] = referrer
+		}
+		nodes = append(nodes, node)
+	}
+	w.graph.Nodes = nodes
+
+	// forget the removed nodes shared by the packages
+	for key, node := range w.shared.packages {
+		if removed[node] {
+			delete(w.shared.packages, key)
+		}
+	}
+	for key, node := range w.shared.pluginNodes {
+		if removed[node] {
+			delete(w.shared.pluginNodes, key)
+		}
+	}
+	for key, node := range w.shared.fields {
+		if removed[node] {
+			delete(w.shared.fields, key)
+		}
+	}
+	for key, node := range w.shared.globals {
+		if removed[node] {
+			delete(w.shared.globals, key)
+		}
+	}
+	for key, node := range w.shared.mutexVars {
+		if removed[node] {
+			delete(w.shared.mutexVars, key)
+		}
+	}
+}
+
+// extract type-checks and extracts the given packages, in the order of their import path
+// like ExtractGraphFromDir, and updates the diagnostics of the graph.
+func (w *Workspace) extract(paths map[string]bool) {
+	var sorted []string
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	for _, path := range sorted {
+		w.tc.check(path)
+	}
+
+	for _, path := range sorted {
+		pkg := w.pkgs[path]
+		scratch := w.graph.Diagnostics
+		w.graph.Diagnostics = nil
+
+		e := w.shared.extractor(w.fset, w.graph, w.tc, path, w.opts)
+		e.track = func(f *ast.File, nodes []*Node, edges []*Edge) {
+			file := w.fileName(f)
+			for _, node := range nodes {
+				w.nodeFiles[node] = file
+			}
+			for _, edge := range edges {
+				w.edgeFiles[edge] = file
+			}
+		}
+		e.extract(pkg.files...)
+
+		w.pkgDiagnostics[path] = w.graph.Diagnostics
+		w.graph.Diagnostics = scratch
+	}
+
+	// diagnostics are ordered like those of ExtractGraphFromDir: parsing first
+	var diagnostics []Diagnostic
+	var files []string
+	for file := range w.fileDiagnostics {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		diagnostics = append(diagnostics, w.fileDiagnostics[file]...)
+	}
+	var pkgs []string
+	for path := range w.pkgDiagnostics {
+		pkgs = append(pkgs, path)
+	}
+	sort.Strings(pkgs)
+	for _, path := range pkgs {
+		diagnostics = append(diagnostics, w.pkgDiagnostics[path]...)
+	}
+	w.graph.Diagnostics = diagnostics
+}
@@ -0,0 +1,316 @@
+package astro
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// graphSignature describes the nodes, edges and diagnostics of g regardless of their order.
+func graphSignature(g *Graph) []string {
+	attrs := func(m map[string]string) string {
+		var pairs []string
+		for k, v := range m {
+			pairs = append(pairs, k+"="+v)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	}
+
+	var lines []string
+	for _, node := range g.Nodes {
+		lines = append(lines, fmt.Sprintf("node %s %s {%s}", node.Type, node.Name, attrs(node.Attrs)))
+	}
+	for _, edge := range g.Edges {
+		lines = append(lines, fmt.Sprintf("edge %s%s-[:%s {%s}]->%s%s", edge.From.Type, edge.From, edge.Relation, attrs(edge.Attrs), edge.To.Type, edge.To))
+	}
+	for _, d := range g.Diagnostics {
+		lines = append(lines, "diagnostic "+d.String())
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// compareGraphs fails t if got and expected differ regardless of their order.
+func compareGraphs(t *testing.T, got, expected *Graph) {
+	t.Helper()
+
+	gotLines, expectedLines := graphSignature(got), graphSignature(expected)
+	missing := make(map[string]int)
+	for _, line := range expectedLines {
+		missing[line]++
+	}
+	for _, line := range gotLines {
+		missing[line]--
+	}
+	for line, count := range missing {
+		switch {
+		case count > 0:
+			t.Errorf("Missing %s", line)
+		case count < 0:
+			t.Errorf("Unexpected %s", line)
+		}
+	}
+	if len(gotLines) != len(expectedLines) {
+		t.Errorf("Expected %d nodes, edges and diagnostics, got %d", len(expectedLines), len(gotLines))
+	}
+}
+
+func TestWorkspace_Update(t *testing.T) {
+	t.Parallel()
+
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.21\n",
+		"main.go": `package main
+
+import "example.com/app/store"
+
+var requests int
+
+func main() {
+	requests++
+	conn, err := store.Open("db")
+	_ = err
+	conn.Close()
+}
+`,
+		"store/store.go": `package store
+
+var Default *Conn
+
+type Conn struct {
+	name string
+}
+
+func Open(name string) (*Conn, error) {
+	return &Conn{name: name}, nil
+}
+`,
+		"store/close.go": `package store
+
+import "fmt"
+
+func (c *Conn) Close() {
+	fmt.Println("closing", c.name)
+}
+`,
+	})
+
+	ws, err := NewWorkspace(root)
+	if err != nil {
+		t.Fatalf("Error creating workspace: %s", err)
+	}
+	full, err := ExtractGraphFromDir(root)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+	compareGraphs(t, ws.Graph(), full)
+
+	updates := []struct {
+		name string
+		path string
+		src  string // empty to remove the file
+	}{
+		{
+			name: "change a function called by another package",
+			path: "store/store.go",
+			src: `package store
+
+var Default *Conn
+
+type Conn struct {
+	name string
+	open bool
+}
+
+func Open(name string) (*Conn, error) {
+	Default = &Conn{name: name, open: true}
+	return Default, validate(name)
+}
+
+func validate(name string) error {
+	return nil
+}
+`,
+		},
+		{
+			name: "change a file importing another package",
+			path: "main.go",
+			src: `package main
+
+import (
+	"example.com/app/store"
+	"example.com/app/util"
+)
+
+func main() {
+	conn, _ := store.Open(util.Name())
+	conn.Close()
+}
+`,
+		},
+		{
+			name: "add a package imported by an extracted one",
+			path: "util/util.go",
+			src: `package util
+
+func Name() string {
+	return "db"
+}
+`,
+		},
+		{
+			name: "remove a file",
+			path: "store/close.go",
+		},
+		{
+			name: "add a file to a package",
+			path: "store/close_all.go",
+			src: `package store
+
+func (c *Conn) Close() {
+	c.open = false
+}
+`,
+		},
+	}
+
+	for _, update := range updates {
+		path := filepath.Join(root, filepath.FromSlash(update.path))
+		if update.src == "" {
+			if err := ws.Remove(update.path); err != nil {
+				t.Fatalf("%s: Error removing file: %s", update.name, err)
+			}
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			if err := ws.Update(update.path, update.src); err != nil {
+				t.Fatalf("%s: Error updating file: %s", update.name, err)
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(update.src), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		full, err := ExtractGraphFromDir(root)
+		if err != nil {
+			t.Fatalf("%s: Error extracting graph: %s", update.name, err)
+		}
+		t.Run(update.name, func(t *testing.T) {
+			compareGraphs(t, ws.Graph(), full)
+		})
+	}
+}
+
+func TestWorkspace_UpdateImportedMutex(t *testing.T) {
+	t.Parallel()
+
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.21\n",
+		"lock/lock.go": `package lock
+
+import "sync"
+
+var Mu sync.Mutex
+`,
+		"main.go": `package main
+
+import "example.com/app/lock"
+
+func main() {
+	lock.Mu.Lock()
+	defer lock.Mu.Unlock()
+}
+`,
+	})
+
+	ws, err := NewWorkspace(root)
+	if err != nil {
+		t.Fatalf("Error creating workspace: %s", err)
+	}
+
+	// the mutex node is only referred to by the updated file
+	src := `package main
+
+import "example.com/app/lock"
+
+func main() {
+	run()
+}
+
+func run() {
+	lock.Mu.Lock()
+	lock.Mu.Unlock()
+}
+`
+	if err := ws.Update("main.go", src); err != nil {
+		t.Fatalf("Error updating file: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	full, err := ExtractGraphFromDir(root)
+	if err != nil {
+		t.Fatalf("Error extracting graph: %s", err)
+	}
+	compareGraphs(t, ws.Graph(), full)
+	if mu := findNode(ws.Graph(), Mutex, "example.com/app/lock.Mu"); mu == nil {
+		t.Errorf("Expected the mutex lock.Mu in the graph")
+	}
+}
+
+func TestWorkspace_Contribution(t *testing.T) {
+	t.Parallel()
+
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.21\n",
+		"main.go": `package main
+
+func main() {
+	helper()
+}
+`,
+		"util.go": `package main
+
+func helper() {}
+`,
+	})
+
+	ws, err := NewWorkspace(root)
+	if err != nil {
+		t.Fatalf("Error creating workspace: %s", err)
+	}
+
+	nodes, edges := ws.Contribution("util.go")
+	if len(nodes) != 0 {
+		t.Errorf("Expected the node of helper to come from its call, got %v", nodes)
+	}
+	if len(edges) != 1 || edges[0].String() != "(example.com/app)-[:Declares]->(example.com/app.helper)" {
+		t.Errorf("Expected util.go to declare helper, got %v", edges)
+	}
+
+	// a file that cannot be parsed leaves the graph unchanged
+	before := graphSignature(ws.Graph())
+	if err := ws.Update("util.go", "package main\n\nfunc helper( {}\n"); err == nil {
+		t.Errorf("Expected an error parsing the file")
+	}
+	if after := graphSignature(ws.Graph()); len(after) != len(before) {
+		t.Errorf("Expected the graph to be unchanged, got %v", after)
+	}
+
+	// files the extraction skips are ignored
+	if err := ws.Update("util_test.go", "package main\n\nfunc TestHelper() {}\n"); err != nil {
+		t.Errorf("Expected test files to be ignored, got %s", err)
+	}
+	if _, edges := ws.Contribution("util_test.go"); len(edges) != 0 {
+		t.Errorf("Expected test files to be ignored, got %v", edges)
+	}
+}